@@ -3,36 +3,210 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 )
 
+// badWordsColumns are the columns of mw_bad_words the tree loads, in the order it reads
+// them, with the value a row gets when the column is null. only bw_word is required,
+// the others were added over time, and a table that does not have them yet loads
+// with their defaults.
+//
+//	bw_id               the row id, for the load report
+//	bw_word             the pattern
+//	bw_dont_start_with  the characters the match may not follow
+//	bw_dont_end_with    the characters the match may not be followed by
+//	bw_allow_prefixes   a boolean, a ^ match may follow hebrew prefix letters
+//	bw_allow_separators a boolean, separators may appear between the letters
+//	bw_collapse_repeats a boolean, a letter matches a run of itself, null follows COLLAPSE_REPEATS
+//	bw_max_distance     0 to 2, the number of edits a match may differ from the word by
+//	bw_severity         how offensive the word is, the higher the worse, 0 is unset
+//	bw_category         the kind of the word, such as profanity, hate or spam
+//	bw_replacement      the text a match is masked with, empty for asterisks
+var badWordsColumns = []struct{ name, fallback string }{
+	{"bw_id", "0"},
+	{"bw_word", ""},
+	{"bw_dont_start_with", "''"},
+	{"bw_dont_end_with", "''"},
+	{"bw_allow_prefixes", "FALSE"},
+	{"bw_allow_separators", "FALSE"},
+	{"bw_collapse_repeats", "NULL"},
+	{"bw_max_distance", "0"},
+	{"bw_severity", "0"},
+	{"bw_category", "''"},
+	{"bw_replacement", "''"},
+}
+
+// columnsQueries list the columns of mw_bad_words in every supported dialect.
+// the driver name is the same as the DB_TYPE.
+var columnsQueries = map[string]string{
+	"mysql": "SELECT column_name FROM information_schema.columns " +
+		"WHERE table_schema = DATABASE() AND table_name = 'mw_bad_words'",
+	"postgres": "SELECT column_name FROM information_schema.columns " +
+		"WHERE table_schema = current_schema() AND table_name = 'mw_bad_words'",
+	"sqlite": "SELECT name FROM pragma_table_info('mw_bad_words')",
+}
+
+// confusablesQuery loads the leetspeak and homoglyph table moderators keep next to the words.
+const confusablesQuery = "SELECT bwc_from, bwc_to FROM mw_bad_words_confusables"
+
+// exceptionsQuery loads the words and phrases a match may appear inside, like Scunthorpe.
+const exceptionsQuery = "SELECT bwe_phrase FROM mw_bad_words_exceptions"
+
+const (
+	// connectAttempts is how many times GetConn tries to reach the database before it gives up.
+	connectAttempts = 5
+	// the wait between attempts starts at firstBackoff and doubles up to maxBackoff.
+	firstBackoff = 500 * time.Millisecond
+	maxBackoff   = 8 * time.Second
+)
+
+// DataBase wraps the connection pool. it does not hold a connection of its own,
+// every caller gets a fresh one, so a connection that was closed or broken
+// is never handed out again.
 type DataBase struct {
-	db   *sql.DB
-	conn *sql.Conn
+	db               *sql.DB
+	dbType           string
+	connectionString string
 }
 
 func NewDataBase(ctx context.Context, dbType, dbConnectionString string) (*DataBase, error) {
+	if _, ok := columnsQueries[dbType]; !ok {
+		return nil, fmt.Errorf("unsupported database type %q", dbType)
+	}
 	db, err := sql.Open(dbType, dbConnectionString)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := db.Conn(ctx)
+	database := &DataBase{db: db, dbType: dbType, connectionString: dbConnectionString}
+	conn, err := database.GetConn(ctx)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	return &DataBase{db: db, conn: conn}, nil
+	conn.Close()
+	return database, nil
+}
+
+// BadWordsQuery returns the query that loads mw_bad_words, with the columns of
+// badWordsColumns the table has and the defaults of the ones it does not.
+// it looks at the table every time, so a migration is picked up by the next reload.
+func (db *DataBase) BadWordsQuery(ctx context.Context) (string, error) {
+	selected, err := db.selectedColumns(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "SELECT " + strings.Join(selected, ", ") + " FROM mw_bad_words", nil
 }
+
+// selectedColumns returns what BadWordsQuery selects for every one of badWordsColumns.
+func (db *DataBase) selectedColumns(ctx context.Context) ([]string, error) {
+	rows, err := db.db.QueryContext(ctx, columnsQueries[db.dbType])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the columns of mw_bad_words: %w", err)
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		existing[strings.ToLower(name)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !existing["bw_word"] {
+		return nil, fmt.Errorf("mw_bad_words does not exist or has no bw_word column")
+	}
+	selected := make([]string, len(badWordsColumns))
+	for i, column := range badWordsColumns {
+		switch {
+		case !existing[column.name]:
+			selected[i] = column.fallback
+		case column.fallback == "" || column.fallback == "NULL":
+			selected[i] = column.name
+		default:
+			selected[i] = fmt.Sprintf("COALESCE(%s, %s)", column.name, column.fallback)
+		}
+	}
+	return selected, nil
+}
+
+// GetConn returns a new connection from the pool that answered a ping.
+// while the database is unavailable it retries with an exponential backoff.
+// the caller must close the connection.
 func (db *DataBase) GetConn(ctx context.Context) (*sql.Conn, error) {
+	backoff := firstBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var conn *sql.Conn
+		if conn, err = db.connect(ctx); err == nil {
+			return conn, nil
+		}
+		if attempt == connectAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+	return nil, fmt.Errorf("database unavailable after %d attempts: %w", connectAttempts, err)
+}
+
+func (db *DataBase) connect(ctx context.Context) (*sql.Conn, error) {
 	conn, err := db.db.Conn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	db.conn = conn
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
 
-	return db.conn, nil
+// Confusables returns the from, to pairs of mw_bad_words_confusables.
+func (db *DataBase) Confusables(ctx context.Context) ([][2]string, error) {
+	rows, err := db.db.QueryContext(ctx, confusablesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pairs [][2]string
+	for rows.Next() {
+		var pair [2]string
+		if err := rows.Scan(&pair[0], &pair[1]); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
 }
-func (db *DataBase) CloseConnection() {
-	db.conn.Close()
+
+// Exceptions returns the phrases of mw_bad_words_exceptions.
+func (db *DataBase) Exceptions(ctx context.Context) ([]string, error) {
+	rows, err := db.db.QueryContext(ctx, exceptionsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var phrases []string
+	for rows.Next() {
+		var phrase string
+		if err := rows.Scan(&phrase); err != nil {
+			return nil, err
+		}
+		phrases = append(phrases, phrase)
+	}
+	return phrases, rows.Err()
 }
+
 func (db *DataBase) Close() {
 	db.db.Close()
 }
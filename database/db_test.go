@@ -0,0 +1,338 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mekavehamichlolay/bad-word-service/maptree"
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+	"github.com/mekavehamichlolay/bad-word-service/tree"
+)
+
+// newSQLite creates a temporary sqlite file with a mw_bad_words table holding rows.
+func newSQLite(t *testing.T, rows [][3]any) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bad-words.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE mw_bad_words (
+		bw_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bw_word TEXT NOT NULL,
+		bw_dont_start_with TEXT,
+		bw_dont_end_with TEXT,
+		bw_allow_prefixes INTEGER,
+		bw_allow_separators INTEGER,
+		bw_collapse_repeats INTEGER,
+		bw_max_distance INTEGER,
+		bw_severity INTEGER,
+		bw_category TEXT,
+		bw_replacement TEXT
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if _, err := db.Exec("INSERT INTO mw_bad_words (bw_word, bw_dont_start_with, bw_dont_end_with) VALUES (?, ?, ?)", row[0], row[1], row[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// badWordsQuery returns the query of db, failing the test if the columns can not be listed.
+func badWordsQuery(t *testing.T, db *DataBase) string {
+	t.Helper()
+	query, err := db.BadWordsQuery(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+func TestSQLiteReset(t *testing.T) {
+	path := newSQLite(t, [][3]any{
+		{"^bad", nil, nil},
+		{"מילה", "ה", ""},
+		{"word$", "", nil},
+	})
+	ctx := context.Background()
+	db, err := NewDataBase(ctx, "sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// both engines read the same columns
+	engines := map[string]matcher.Matcher{"maptree": maptree.NewTree(), "tree": tree.NewTree()}
+	for name, words := range engines {
+		// Reset closes the connection, every reset must get a fresh one
+		for i := 0; i < 2; i++ {
+			conn, err := db.GetConn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := words.Reset(ctx, conn, badWordsQuery(t, db)); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		got := words.HasWord("a bad word, המילה מילה")
+		want := [][2]uint{{2, 5}, {6, 10}, {18, 22}}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: HasWord() = %v, want %v", name, got, want)
+		}
+		if matches := words.Matches("word"); len(matches) != 1 || matches[0].Word.ID != 3 {
+			t.Errorf("%s: Matches() = %v, want the row 3", name, matches)
+		}
+	}
+}
+
+func TestUnsupportedType(t *testing.T) {
+	if _, err := NewDataBase(context.Background(), "oracle", ""); err == nil {
+		t.Error("NewDataBase() with an unsupported type did not fail")
+	}
+}
+
+func TestResetSkipsBadRows(t *testing.T) {
+	path := newSQLite(t, [][3]any{{"bad", nil, nil}, {"[a", nil, nil}, {"word", nil, nil}, {"bad", nil, nil}})
+	ctx := context.Background()
+	db, err := NewDataBase(ctx, "sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tree := maptree.NewTree()
+	conn, err := db.GetConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Reset(ctx, conn, badWordsQuery(t, db)); err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Has("bad") || !tree.Has("word") {
+		t.Errorf("the rows after a bad row were not loaded")
+	}
+	report := tree.Report()
+	var ids []int64
+	for _, skipped := range report.Skipped {
+		ids = append(ids, skipped.ID)
+	}
+	if report.Words != 2 || !slices.Equal(ids, []int64{2, 4}) || report.Error != "" {
+		t.Errorf("Report() = %+v, want 2 words and the rows 2 and 4 skipped", report)
+	}
+}
+
+func TestReportsIgnoredOptions(t *testing.T) {
+	path := newSQLite(t, [][3]any{{"bad", nil, nil}, {"word", nil, nil}, {"ugly", nil, nil}})
+	ctx := context.Background()
+	db, err := NewDataBase(ctx, "sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.db.ExecContext(ctx, "UPDATE mw_bad_words SET bw_allow_separators = 1, bw_max_distance = 1 WHERE bw_id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.db.ExecContext(ctx, "UPDATE mw_bad_words SET bw_collapse_repeats = 0 WHERE bw_id = 3"); err != nil {
+		t.Fatal(err)
+	}
+	// the row is still loaded, the report tells it matches without some of its options.
+	// the tree has no separators and distances, and a word of four letters allows no distance
+	engines := map[string]struct {
+		words matcher.Matcher
+		error string
+	}{
+		"maptree": {maptree.NewTree(), "the edit distance is lowered to 0, the most a word of 4 letters allows"},
+		"tree":    {tree.NewTree(), "the tree engine ignores bw_allow_separators, bw_max_distance"},
+	}
+	for name, engine := range engines {
+		conn, err := db.GetConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.words.Reset(ctx, conn, badWordsQuery(t, db)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		report := engine.words.Report()
+		want := []matcher.RowError{{ID: 2, Pattern: "word", Error: engine.error}}
+		if report.Words != 3 || len(report.Skipped) != 0 || !slices.Equal(report.Ignored, want) {
+			t.Errorf("%s: Report() = %+v, want 3 words and the row 2 ignored", name, report)
+		}
+		if !slices.Equal(engine.words.HasWord("a word"), [][2]uint{{2, 6}}) {
+			t.Errorf("%s: the row with ignored options was not loaded", name)
+		}
+	}
+}
+
+func TestFailedResetKeepsList(t *testing.T) {
+	path := newSQLite(t, [][3]any{{"bad", nil, nil}})
+	ctx := context.Background()
+	db, err := NewDataBase(ctx, "sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tree := maptree.NewTree()
+	reset := func() error {
+		conn, err := db.GetConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree.Reset(ctx, conn, badWordsQuery(t, db))
+	}
+	if err := reset(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.GetConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(ctx, "UPDATE mw_bad_words SET bw_word = '[a'"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := reset(); err == nil {
+		t.Fatal("Reset() without a valid row did not fail")
+	}
+	if !tree.Has("bad") {
+		t.Errorf("a failed reset changed the active list")
+	}
+	if report := tree.Report(); report.Error == "" || report.Words != 1 || len(report.Skipped) != 1 {
+		t.Errorf("Report() = %+v, want the error, the active word and the skipped row", report)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	path := newSQLite(t, [][3]any{{"bad", nil, nil}, {"word", "a", "b"}})
+	ctx := context.Background()
+	db, err := NewDataBase(ctx, "sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	first, err := db.Fingerprint(ctx, Watched{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := db.Fingerprint(ctx, Watched{}); again != first {
+		t.Errorf("Fingerprint() changed without a change in the table")
+	}
+	if _, err := db.db.ExecContext(ctx, "UPDATE mw_bad_words SET bw_dont_end_with = 'c' WHERE bw_word = 'word'"); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := db.Fingerprint(ctx, Watched{}); changed == first {
+		t.Errorf("Fingerprint() did not notice the update")
+	}
+}
+
+func TestOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad-words.db")
+	ctx := context.Background()
+	db, err := NewDataBase(ctx, "sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.BadWordsQuery(ctx); err == nil {
+		t.Error("BadWordsQuery() without mw_bad_words did not fail")
+	}
+	exec := func(statement string) {
+		if _, err := db.db.ExecContext(ctx, statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(severity int) {
+		t.Helper()
+		if _, err := db.Fingerprint(ctx, Watched{}); err != nil {
+			t.Errorf("Fingerprint() = %v", err)
+		}
+		words := maptree.NewTree()
+		conn, err := db.GetConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := words.Reset(ctx, conn, badWordsQuery(t, db)); err != nil {
+			t.Fatal(err)
+		}
+		matches := words.Matches("bad word xword")
+		if len(matches) != 2 || matches[0].Word.ID != 0 || matches[0].Word.Severity != severity || matches[0].Word.Category != "" {
+			t.Errorf("Matches() = %+v, want bad and word with the severity %d and the defaults", matches, severity)
+		}
+	}
+	// the table as it was before the options were added
+	exec("CREATE TABLE mw_bad_words (bw_word TEXT NOT NULL, bw_dont_start_with TEXT, bw_dont_end_with TEXT)")
+	exec("INSERT INTO mw_bad_words VALUES ('^bad', NULL, NULL), ('word$', 'x', '')")
+	check(0)
+	// and half way migrated
+	exec("ALTER TABLE mw_bad_words ADD COLUMN bw_severity INTEGER")
+	exec("UPDATE mw_bad_words SET bw_severity = 2")
+	check(2)
+}
+
+func TestWatchedTables(t *testing.T) {
+	path := newSQLite(t, [][3]any{{"cunt", nil, nil}})
+	ctx := context.Background()
+	db, err := NewDataBase(ctx, "sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	exec := func(statement string) {
+		if _, err := db.db.ExecContext(ctx, statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("CREATE TABLE mw_bad_words_confusables (bwc_from TEXT, bwc_to TEXT)")
+	exec("CREATE TABLE mw_bad_words_exceptions (bwe_phrase TEXT)")
+	watched := Watched{Confusables: true, Exceptions: true}
+	first, err := db.Fingerprint(ctx, watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwatched, err := db.Fingerprint(ctx, Watched{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec("INSERT INTO mw_bad_words_exceptions VALUES ('Scunthorpe')")
+	if changed, _ := db.Fingerprint(ctx, watched); changed == first {
+		t.Errorf("Fingerprint() did not notice the new exception")
+	}
+	first, _ = db.Fingerprint(ctx, watched)
+	exec("INSERT INTO mw_bad_words_confusables VALUES ('@', 'a')")
+	if changed, _ := db.Fingerprint(ctx, watched); changed == first {
+		t.Errorf("Fingerprint() did not notice the new confusable")
+	}
+	if again, _ := db.Fingerprint(ctx, Watched{}); again != unwatched {
+		t.Errorf("Fingerprint() without the watched tables changed with them")
+	}
+
+	// the exceptions a reload prepares change nothing until its Reset
+	tree := maptree.NewTree()
+	conn, err := db.GetConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Reset(ctx, conn, badWordsQuery(t, db)); err != nil {
+		t.Fatal(err)
+	}
+	phrases, err := db.Exceptions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.PrepareExceptions(phrases)
+	if got := tree.HasWord("Scunthorpe"); len(got) != 1 {
+		t.Errorf("HasWord() before the Reset = %v, want the match", got)
+	}
+	if conn, err = db.GetConn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Reset(ctx, conn, badWordsQuery(t, db)); err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.HasWord("Scunthorpe"); got != nil {
+		t.Errorf("HasWord() after the Reset = %v, want the exception to drop it", got)
+	}
+}
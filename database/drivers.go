@@ -0,0 +1,27 @@
+package database
+
+// the drivers for every DB_TYPE that server.Configure accepts.
+// sqlite is the pure go port, so the service still builds without cgo.
+import (
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("bad_words_hash", -1, hashRow)
+}
+
+// hashRow is bad_words_hash, the row hash of the sqlite fingerprint. it hashes the
+// type of every value too, so a null differs from an empty string.
+func hashRow(_ *sqlite.FunctionContext, values []driver.Value) (driver.Value, error) {
+	hash := fnv.New32a()
+	for _, value := range values {
+		fmt.Fprintf(hash, "%T:%v\x00", value, value)
+	}
+	return int64(hash.Sum32()), nil
+}
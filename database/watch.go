@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/mekavehamichlolay/bad-word-service/loger"
+)
+
+// NotifyChannel is the channel postgres databases notify when mw_bad_words changes.
+// the wiki side needs a trigger such as the one below, on mw_bad_words_confusables and
+// mw_bad_words_exceptions too when they are loaded
+//
+//	CREATE FUNCTION notify_bad_words() RETURNS trigger AS $$
+//	BEGIN PERFORM pg_notify('mw_bad_words', ''); RETURN NULL; END; $$ LANGUAGE plpgsql;
+//	CREATE TRIGGER mw_bad_words_notify AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON mw_bad_words
+//	FOR EACH STATEMENT EXECUTE FUNCTION notify_bad_words();
+const NotifyChannel = "mw_bad_words"
+
+// Watched are the tables a reload reads besides mw_bad_words, so a change to them reloads too.
+type Watched struct {
+	Confusables, Exceptions bool
+}
+
+// Watch calls reload whenever mw_bad_words or one of the watched tables changes, until ctx is done.
+// postgres databases are told about changes with LISTEN/NOTIFY, the others are
+// polled every interval. a failed reload is logged and tried again on the next change.
+func (db *DataBase) Watch(ctx context.Context, interval time.Duration, watched Watched, reload func() error, log loger.Loger) {
+	if db.dbType == "postgres" {
+		err := db.listen(ctx, interval, reload, log)
+		if err == nil {
+			return
+		}
+		log.Warn(fmt.Sprintf("Failed to listen to %s, polling instead: %v", NotifyChannel, err))
+	}
+	db.poll(ctx, interval, watched, reload, log)
+}
+
+func (db *DataBase) poll(ctx context.Context, interval time.Duration, watched Watched, reload func() error, log loger.Loger) {
+	last, err := db.Fingerprint(ctx, watched)
+	if err != nil {
+		log.Err(fmt.Sprintf("Failed to check the bad words for changes: %v", err))
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fingerprint, err := db.Fingerprint(ctx, watched)
+		if err != nil {
+			log.Err(fmt.Sprintf("Failed to check the bad words for changes: %v", err))
+			continue
+		}
+		if fingerprint == last {
+			continue
+		}
+		log.Info("The bad words changed, reloading")
+		if err := reload(); err != nil {
+			log.Err(fmt.Sprintf("Failed to reload the changed bad words: %v", err))
+			continue
+		}
+		last = fingerprint
+	}
+}
+
+func (db *DataBase) listen(ctx context.Context, interval time.Duration, reload func() error, log loger.Loger) error {
+	listener := pq.NewListener(db.connectionString, firstBackoff, maxBackoff, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Warn(fmt.Sprintf("The %s listener: %v", NotifyChannel, err))
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(NotifyChannel); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// notifications sent while the listener was reconnecting are lost,
+			// the ping makes sure a broken connection is noticed and reestablished
+			if err := listener.Ping(); err != nil {
+				log.Warn(fmt.Sprintf("The %s listener: %v", NotifyChannel, err))
+			}
+			continue
+		case <-listener.NotificationChannel():
+			// a nil notification means the connection was reestablished, and
+			// changes might have been missed, so it reloads as well
+		}
+		log.Info("The bad words changed, reloading")
+		if err := reload(); err != nil {
+			log.Err(fmt.Sprintf("Failed to reload the changed bad words: %v", err))
+		}
+	}
+}
+
+// rowHashes hash a row of the columns to a 32 bit number in every supported dialect.
+// sqlite has no hash function, drivers.go registers bad_words_hash for it.
+var rowHashes = map[string]func(columns []string) string{
+	"mysql": func(columns []string) string {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			// QUOTE tells a null from an empty string
+			quoted[i] = "QUOTE(" + column + ")"
+		}
+		return "CRC32(CONCAT_WS(',', " + strings.Join(quoted, ", ") + "))"
+	},
+	"postgres": func(columns []string) string {
+		return "hashtext(ROW(" + strings.Join(columns, ", ") + ")::text)"
+	},
+	"sqlite": func(columns []string) string {
+		return "bad_words_hash(" + strings.Join(columns, ", ") + ")"
+	},
+}
+
+// Fingerprint returns a checksum of the rows the tree loads, from mw_bad_words and
+// the watched tables. it hashes the same columns as the reload reads, so a change to
+// any of them is noticed. the database counts and hashes the rows itself, so a poll
+// reads two numbers for every table instead of the rows.
+func (db *DataBase) Fingerprint(ctx context.Context, watched Watched) (string, error) {
+	columns, err := db.selectedColumns(ctx)
+	if err != nil {
+		return "", err
+	}
+	type table struct {
+		name    string
+		columns []string
+	}
+	tables := []table{{"mw_bad_words", columns}}
+	// the columns of confusablesQuery and exceptionsQuery
+	if watched.Confusables {
+		tables = append(tables, table{"mw_bad_words_confusables", []string{"bwc_from", "bwc_to"}})
+	}
+	if watched.Exceptions {
+		tables = append(tables, table{"mw_bad_words_exceptions", []string{"bwe_phrase"}})
+	}
+	checksums := make([]string, len(tables))
+	for i, table := range tables {
+		if checksums[i], err = db.checksum(ctx, table.name, table.columns); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(checksums, "/"), nil
+}
+
+// checksum returns the number of rows of table and the sum of the hashes of their
+// columns. the hashes are summed, so the order of the rows does not matter, and they
+// are 32 bit, so the sum does not overflow.
+func (db *DataBase) checksum(ctx context.Context, table string, columns []string) (string, error) {
+	query := fmt.Sprintf("SELECT COUNT(*), COALESCE(SUM(%s), 0) FROM %s", rowHashes[db.dbType](columns), table)
+	var count, sum int64
+	if err := db.db.QueryRowContext(ctx, query).Scan(&count, &sum); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%x", count, sum), nil
+}
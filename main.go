@@ -1,24 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-
 	"github.com/mekavehamichlolay/bad-word-service/database"
 	"github.com/mekavehamichlolay/bad-word-service/loger"
 	"github.com/mekavehamichlolay/bad-word-service/maptree"
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
 	"github.com/mekavehamichlolay/bad-word-service/server"
+	"github.com/mekavehamichlolay/bad-word-service/tree"
 )
 
+// lineWait is how long the all and explain sockets wait for a line the client
+// neither ends with a new line nor by closing its side
+const lineWait = 500 * time.Millisecond
+
 func main() {
 	config := server.Configure()
 	if config == nil {
@@ -43,19 +51,98 @@ func main() {
 	}
 	defer db.Close()
 
-	conn, err := db.GetConn(ctx)
-	if err != nil {
-		log.Err(fmt.Sprintf("Failed to get connection to database: %v", err))
-		return
+	// words is the engine the texts are checked with, mapTree is set only when it is maptree,
+	// as the confusables, the exceptions and the explain socket are maptree features
+	var words matcher.Matcher
+	var mapTree *maptree.Tree
+	if config.Engine == "tree" {
+		words = tree.NewTree()
+		if config.Confusables != "" || config.CollapseRepeats || config.Exceptions {
+			log.Warn("The tree engine ignores CONFUSABLES, COLLAPSE_REPEATS and EXCEPTIONS")
+		}
+	} else {
+		mapTree = maptree.NewTree()
+		mapTree.SetCollapseRepeats(config.CollapseRepeats)
+		words = mapTree
+	}
+	if mapTree != nil && config.Confusables == "leetspeak" {
+		mapTree.SetConfusables(maptree.LeetspeakConfusables())
+	} else if mapTree != nil && config.Confusables != "" && config.Confusables != "database" {
+		file, err := os.Open(config.Confusables)
+		if err != nil {
+			log.Err(fmt.Sprintf("Failed to open the confusables file: %v", err))
+			return
+		}
+		confusables, err := maptree.LoadConfusables(file)
+		file.Close()
+		if err != nil {
+			log.Err(fmt.Sprintf("Failed to load the confusables file: %v", err))
+			return
+		}
+		mapTree.SetConfusables(confusables)
+	}
+
+	// every reset takes its own connection from the pool, Reset closes it when it is done.
+	// if the database is down the tree keeps the words it already has.
+	// the watcher and the reset socket may reset at the same time, reloading keeps the
+	// confusables and the exceptions of one reset from mixing with the words of another
+	var reloading sync.Mutex
+	reset := func() error {
+		reloading.Lock()
+		defer reloading.Unlock()
+		if mapTree != nil && config.Confusables == "database" {
+			pairs, err := db.Confusables(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to load the confusables: %w", err)
+			}
+			confusables, err := maptree.NewConfusables(pairs)
+			if err != nil {
+				return fmt.Errorf("failed to load the confusables: %w", err)
+			}
+			mapTree.SetConfusables(confusables)
+		}
+		if mapTree != nil && config.Exceptions {
+			phrases, err := db.Exceptions(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to load the exceptions: %w", err)
+			}
+			mapTree.PrepareExceptions(phrases)
+		}
+		conn, err := db.GetConn(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get connection to database: %w", err)
+		}
+		query, err := db.BadWordsQuery(ctx)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		if err := words.Reset(ctx, conn, query); err != nil {
+			return err
+		}
+		for _, skipped := range words.Report().Skipped {
+			log.Warn(fmt.Sprintf("Skipped the row %d of mw_bad_words %q: %s", skipped.ID, skipped.Pattern, skipped.Error))
+		}
+		return nil
 	}
-	defer db.CloseConnection()
 
-	tree := maptree.NewTree()
-	if err := tree.Reset(ctx, conn); err != nil {
+	if err := reset(); err != nil {
 		log.Err(fmt.Sprintf("Failed to reset the tree: %v", err))
 		return
 	}
 
+	if config.RefreshInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watched := database.Watched{
+				Confusables: mapTree != nil && config.Confusables == "database",
+				Exceptions:  mapTree != nil && config.Exceptions,
+			}
+			db.Watch(ctx, config.RefreshInterval, watched, reset, log)
+		}()
+	}
+
 	mainRoute := server.CreateRoute(
 		config.SocketPath,
 		"main socket for the bad word service",
@@ -86,23 +173,82 @@ func main() {
 					break
 				}
 			}
-			positions := tree.HasWord(text)
-			jsoned, err := json.Marshal(positions)
+			request, err := server.ParseRequest([]byte(text))
+			if err != nil {
+				log.Err(fmt.Sprintf("Failed to parse the request: %v", err))
+				c.Write(errorResponse(err))
+				return
+			}
+			jsoned, err := check(words, request)
 			if err != nil {
 				log.Err(fmt.Sprintf("Failed to marshal the positions: %v", err))
 				return
 			}
 			c.Write(jsoned)
 		})
+	framedRoute := server.CreateRoute(
+		config.SocketPath+"framed",
+		"framed socket for the bad word service, many length prefixed texts per connection",
+		func(c net.Conn) {
+			defer c.Close()
+
+			reader := bufio.NewReader(c)
+			for {
+				// the deadline is an idle timeout, it is extended for every request
+				if err := c.SetDeadline(time.Now().Add(time.Minute)); err != nil {
+					log.Err(fmt.Sprintf("Failed to set deadline: %v", err))
+					return
+				}
+				payload, err := server.ReadFrame(reader)
+				if err != nil {
+					if err != io.EOF {
+						log.Err(fmt.Sprintf("Failed to read a frame from the connection: %v", err))
+					}
+					return
+				}
+				var jsoned []byte
+				if request, err := server.ParseRequest(payload); err != nil {
+					// the frame is complete, so the connection can go on with the next one
+					log.Err(fmt.Sprintf("Failed to parse the request: %v", err))
+					jsoned = errorResponse(err)
+				} else if jsoned, err = check(words, request); err != nil {
+					log.Err(fmt.Sprintf("Failed to marshal the positions: %v", err))
+					return
+				}
+				if err := server.WriteFrame(c, jsoned); err != nil {
+					log.Err(fmt.Sprintf("Failed to write a frame to the connection: %v", err))
+					return
+				}
+			}
+		})
 	resetRoute := server.CreateRoute(
 		config.SocketPath+"reset",
 		"reset socket for the bad word service",
 		func(c net.Conn) {
 			defer c.Close()
-			if err := tree.Reset(ctx, conn); err != nil {
+
+			// the client gets the number of loaded words and skipped rows, or the error while the old list stays active
+			var result struct {
+				Words   int    `json:"words"`
+				Skipped int    `json:"skipped"`
+				Error   string `json:"error,omitempty"`
+			}
+			if err := reset(); err != nil {
 				log.Err(fmt.Sprintf("Failed to reset the tree: %v", err))
+				result.Error = err.Error()
+			}
+			result.Words = words.Len()
+			result.Skipped = len(words.Report().Skipped)
+			jsoned, err := json.Marshal(result)
+			if err != nil {
+				log.Err(fmt.Sprintf("Failed to marshal the reset result: %v", err))
+				return
+			}
+			if err := c.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				log.Err(fmt.Sprintf("Failed to set deadline: %v", err))
 				return
 			}
+			c.Write(jsoned)
 		})
 	killRoute := server.CreateRoute(
 		config.SocketPath+"kill",
@@ -114,12 +260,119 @@ func main() {
 	allWordsRoute := server.CreateRoute(
 		config.SocketPath+"all",
 		"all words socket for the bad word service",
-		func(c net.Conn) { //TODO: implement this route
+		func(c net.Conn) {
+			defer c.Close()
+
+			// the client sends one line with an optional json filter, closes its side, or just reads.
+			// a client that sends nothing for a moment gets all the words, like on the other sockets
+			if err := c.SetReadDeadline(time.Now().Add(lineWait)); err != nil {
+				log.Err(fmt.Sprintf("Failed to set deadline: %v", err))
+				return
+			}
+			line, err := bufio.NewReader(c).ReadBytes('\n')
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// no filter, what was read so far is the whole of it
+				err = nil
+			}
+			if err != nil && err != io.EOF {
+				log.Err(fmt.Sprintf("Failed to read from the connection: %v", err))
+				return
+			}
+			var filter matcher.Filter
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				if err := json.Unmarshal(line, &filter); err != nil {
+					log.Err(fmt.Sprintf("Failed to unmarshal the filter: %v", err))
+					return
+				}
+			}
+
+			if err := c.SetDeadline(time.Now().Add(time.Minute)); err != nil {
+				log.Err(fmt.Sprintf("Failed to set deadline: %v", err))
+				return
+			}
+			writer := bufio.NewWriter(c)
+			encoder := json.NewEncoder(writer)
+			if err := words.Entries(filter, func(entry matcher.Entry) error {
+				return encoder.Encode(entry)
+			}); err != nil {
+				log.Err(fmt.Sprintf("Failed to write the words: %v", err))
+				return
+			}
+			if err := writer.Flush(); err != nil {
+				log.Err(fmt.Sprintf("Failed to write the words: %v", err))
+			}
+		})
+	explainRoute := server.CreateRoute(
+		config.SocketPath+"explain",
+		"explain socket for the bad word service, checks a pattern before it is saved",
+		func(c net.Conn) {
 			defer c.Close()
+
+			// the client sends the pattern, or a json line with the pattern and its options.
+			// like on the all socket, a line that is not ended is all of it once the client stops sending
+			if err := c.SetReadDeadline(time.Now().Add(lineWait)); err != nil {
+				log.Err(fmt.Sprintf("Failed to set deadline: %v", err))
+				return
+			}
+			line, err := bufio.NewReader(c).ReadBytes('\n')
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = nil
+			}
+			if err != nil && err != io.EOF {
+				log.Err(fmt.Sprintf("Failed to read from the connection: %v", err))
+				c.Write(errorResponse(err))
+				return
+			}
+			if err := c.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				log.Err(fmt.Sprintf("Failed to set deadline: %v", err))
+				return
+			}
+			var request struct {
+				Pattern string `json:"pattern"`
+				maptree.Options
+			}
+			if line = bytes.TrimSpace(line); bytes.HasPrefix(line, []byte("{")) {
+				if err := json.Unmarshal(line, &request); err != nil {
+					log.Err(fmt.Sprintf("Failed to unmarshal the pattern: %v", err))
+					c.Write(errorResponse(err))
+					return
+				}
+			} else {
+				request.Pattern = string(line)
+			}
+			jsoned, err := json.Marshal(mapTree.Explain(request.Pattern, request.Options))
+			if err != nil {
+				log.Err(fmt.Sprintf("Failed to marshal the explanation: %v", err))
+				return
+			}
+			c.Write(jsoned)
+		})
+
+	statusRoute := server.CreateRoute(
+		config.SocketPath+"status",
+		"status socket for the bad word service, reports the last reload",
+		func(c net.Conn) {
+			defer c.Close()
+
+			jsoned, err := json.Marshal(words.Report())
+			if err != nil {
+				log.Err(fmt.Sprintf("Failed to marshal the load report: %v", err))
+				return
+			}
+			if err := c.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				log.Err(fmt.Sprintf("Failed to set deadline: %v", err))
+				return
+			}
+			c.Write(jsoned)
 		})
 
 	routes := []*server.Route{
-		mainRoute, resetRoute, killRoute, allWordsRoute,
+		mainRoute, framedRoute, resetRoute, killRoute, allWordsRoute, statusRoute,
+	}
+	if mapTree != nil {
+		routes = append(routes, explainRoute)
 	}
 
 	if err := server.StartServer(ctx, wg, routes, log); err != nil {
@@ -0,0 +1,218 @@
+package maptree
+
+import "github.com/mekavehamichlolay/bad-word-service/utils"
+
+// automaton is an Aho-Corasick matcher compiled from the words of a list.
+// it lets HasWord find every pattern in a single pass over the text instead of
+// building a window for every pattern length.
+//
+// a list has an automaton for every combination of the options that change how
+// the text is read. separators skips the separators of the text, and repeats reads
+// a run of the same rune as one rune, so the patterns are not expanded for them.
+type automaton struct {
+	states              []state
+	separators, repeats bool
+}
+
+type state struct {
+	next map[rune]int32
+	fail int32
+	// out holds every pattern that ends in this state, including the ones
+	// reachable through the fail links, so the scanner never has to follow them.
+	out []output
+}
+
+type output struct {
+	// length is the number of runs the pattern is made of.
+	length int
+	// counts is the minimal length of every run, for the automatons that read repeats.
+	counts []int
+	node   *Node
+}
+
+func newState() state {
+	return state{next: make(map[rune]int32)}
+}
+
+// compile builds the automaton out of the patterns that have the given options.
+// the words that allow an edit distance are left to the fuzzy trie, and the
+// exceptions are read as they are written, so they go to the plain automaton.
+// it returns nil if there are none.
+func compile(children, exceptions map[string]*Node, separators, repeats bool) *automaton {
+	a := &automaton{states: []state{newState()}, separators: separators, repeats: repeats}
+	for word, node := range children {
+		if node.MaxDistance != 0 || node.AllowSeparators != separators || node.CollapseRepeats != repeats {
+			continue
+		}
+		a.insert(word, node)
+	}
+	if !separators && !repeats {
+		for phrase, node := range exceptions {
+			a.insert(phrase, node)
+		}
+	}
+	if len(a.states) == 1 {
+		return nil
+	}
+	// breadth first, so the fail state of every state is done before its children
+	queue := make([]int32, 0, len(a.states))
+	for _, next := range a.states[0].next {
+		queue = append(queue, next)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for char, next := range a.states[cur].next {
+			fail := a.states[cur].fail
+			for {
+				if target, ok := a.states[fail].next[char]; ok {
+					a.states[next].fail = target
+					break
+				}
+				if fail == 0 {
+					a.states[next].fail = 0
+					break
+				}
+				fail = a.states[fail].fail
+			}
+			a.states[next].out = append(a.states[next].out, a.states[a.states[next].fail].out...)
+			queue = append(queue, next)
+		}
+	}
+	return a
+}
+
+// insert adds the path of word to the trie of the automaton.
+func (a *automaton) insert(word string, node *Node) {
+	runes, counts := []rune(word), []int(nil)
+	if a.repeats {
+		runes, counts = runs(runes)
+	}
+	cur := int32(0)
+	for _, char := range runes {
+		next, ok := a.states[cur].next[char]
+		if !ok {
+			next = int32(len(a.states))
+			a.states = append(a.states, newState())
+			a.states[cur].next[char] = next
+		}
+		cur = next
+	}
+	a.states[cur].out = append(a.states[cur].out, output{length: len(runes), counts: counts, node: node})
+}
+
+// runs collapses the runs of the same rune in word, and returns how long every run was.
+func runs(word []rune) ([]rune, []int) {
+	var runes []rune
+	var counts []int
+	for i, char := range word {
+		if i > 0 && char == word[i-1] {
+			counts[len(counts)-1]++
+			continue
+		}
+		runes = append(runes, char)
+		counts = append(counts, 1)
+	}
+	return runes, counts
+}
+
+// step returns the state reached from cur after reading char.
+func (a *automaton) step(cur int32, char rune) int32 {
+	for {
+		if next, ok := a.states[cur].next[char]; ok {
+			return next
+		}
+		if cur == 0 {
+			return 0
+		}
+		cur = a.states[cur].fail
+	}
+}
+
+// reader feeds a text to an automaton and keeps where in the text every rune it read came from.
+type reader struct {
+	*automaton
+	cur int32
+	// the k-th run the automaton read is text[starts[k]:ends[k]], and is counts[k] runes long
+	starts, ends, counts []int
+	// the last run is only fed to the automaton once it ended, so the matches span all of it
+	pending bool
+	last    rune
+}
+
+// read takes the rune at text[i].
+func (r *reader) read(i int, char rune, found func(start, end int, node *Node)) {
+	if !r.separators && !r.repeats {
+		// every rune is read where it is, so the positions need no bookkeeping
+		r.cur = r.step(r.cur, char)
+		for _, o := range r.states[r.cur].out {
+			found(i+1-o.length, i+1, o.node)
+		}
+		return
+	}
+	if r.separators && utils.IsEndOfWordSign(char) {
+		return
+	}
+	if r.pending && char == r.last {
+		r.ends[len(r.ends)-1] = i + 1
+		r.counts[len(r.counts)-1]++
+		return
+	}
+	r.flush(found)
+	r.starts = append(r.starts, i)
+	r.ends = append(r.ends, i+1)
+	r.counts = append(r.counts, 1)
+	r.last = char
+	r.pending = true
+	if !r.repeats {
+		r.flush(found)
+	}
+}
+
+// flush feeds the pending run to the automaton.
+func (r *reader) flush(found func(start, end int, node *Node)) {
+	if !r.pending {
+		return
+	}
+	r.pending = false
+	r.cur = r.step(r.cur, r.last)
+	last := len(r.starts) - 1
+outputs:
+	for _, o := range r.states[r.cur].out {
+		first := last + 1 - o.length
+		for k, count := range o.counts {
+			if r.counts[first+k] < count {
+				continue outputs
+			}
+		}
+		found(r.starts[first], r.ends[last], o.node)
+	}
+}
+
+// scan calls found for every pattern occurrence in text, with the rune
+// positions of its start and end and the edit distance. all the automatons of
+// the list read the text in the same pass, the expressions and the fuzzy trie
+// search it after them. plain is the text before the confusables were applied.
+func (l *list) scan(text, plain []rune, found func(start, end, distance int, node *Node)) {
+	exact := func(start, end int, node *Node) {
+		found(start, end, 0, node)
+	}
+	readers := make([]reader, 0, len(l.automatons))
+	for _, a := range l.automatons {
+		readers = append(readers, reader{automaton: a})
+	}
+	for i, char := range text {
+		for k := range readers {
+			readers[k].read(i, char, exact)
+		}
+	}
+	for k := range readers {
+		readers[k].flush(exact)
+	}
+	for _, m := range l.nfas {
+		m.search(text, plain, exact)
+	}
+	if l.fuzzy != nil {
+		l.fuzzy.search(text, plain, found)
+	}
+}
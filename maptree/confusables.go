@@ -0,0 +1,116 @@
+package maptree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mekavehamichlolay/bad-word-service/utils"
+)
+
+// Confusables maps characters that are used in place of others, leetspeak and
+// homoglyphs, to the character they stand for. it is applied to the patterns and
+// to the text alike, so with the leetspeak "b@d" matches "bad". the keys are folded, and chains are
+// followed, so with 0→o and o→ס a 0 becomes ס.
+type Confusables map[rune]rune
+
+// defaultConfusables is used until a table is loaded. it only has the homoglyphs,
+// letters that look the same as the ones they stand for, so it never turns a
+// character of an ordinary text into a different letter.
+var defaultConfusables = [][2]string{
+	// cyrillic
+	{"а", "a"}, {"в", "b"}, {"е", "e"}, {"і", "i"}, {"ј", "j"}, {"к", "k"}, {"м", "m"}, {"н", "h"},
+	{"о", "o"}, {"р", "p"}, {"с", "c"}, {"ѕ", "s"}, {"т", "t"}, {"у", "y"}, {"х", "x"},
+	{"А", "a"}, {"В", "b"}, {"Е", "e"}, {"І", "i"}, {"Ј", "j"}, {"К", "k"}, {"М", "m"}, {"Н", "h"},
+	{"О", "o"}, {"Р", "p"}, {"С", "c"}, {"Ѕ", "s"}, {"Т", "t"}, {"У", "y"}, {"Х", "x"},
+	// greek
+	{"α", "a"}, {"ι", "i"}, {"κ", "k"}, {"ν", "v"}, {"ο", "o"}, {"ρ", "p"}, {"τ", "t"}, {"υ", "u"},
+}
+
+// leetspeak are the digits and signs written for letters. they are also used as
+// themselves, so they are only applied when asked for.
+var leetspeak = [][2]string{
+	{"0", "o"}, {"1", "i"}, {"!", "i"}, {"3", "e"}, {"4", "a"}, {"@", "a"}, {"$", "s"}, {"5", "s"}, {"7", "t"},
+}
+
+// DefaultConfusables returns the built in table.
+func DefaultConfusables() Confusables {
+	c, _ := NewConfusables(defaultConfusables)
+	return c
+}
+
+// LeetspeakConfusables returns the built in table with the leetspeak added.
+func LeetspeakConfusables() Confusables {
+	c, _ := NewConfusables(append(slices.Clone(defaultConfusables), leetspeak...))
+	return c
+}
+
+// NewConfusables builds a table out of from, to pairs of single characters.
+func NewConfusables(pairs [][2]string) (Confusables, error) {
+	c := make(Confusables, len(pairs))
+	for _, pair := range pairs {
+		from, to := []rune(pair[0]), []rune(pair[1])
+		if len(from) != 1 || len(to) != 1 {
+			return nil, fmt.Errorf("confusable %q → %q is not a pair of single characters", pair[0], pair[1])
+		}
+		c[utils.Fold(from[0])] = utils.Fold(to[0])
+	}
+	// follow the chains once here, so fold is a single lookup
+	for from, to := range c {
+		for steps := 0; steps < len(c); steps++ {
+			next, ok := c[to]
+			if !ok || next == to {
+				break
+			}
+			to = next
+		}
+		c[from] = to
+	}
+	return c, nil
+}
+
+// LoadConfusables reads a table with a pair on every line, the character and the
+// one it stands for separated by white space. empty lines and lines starting with
+// # are skipped.
+func LoadConfusables(r io.Reader) (Confusables, error) {
+	var pairs [][2]string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 || utf8.RuneCountInString(fields[0]) != 1 || utf8.RuneCountInString(fields[1]) != 1 {
+			return nil, fmt.Errorf("line %d: expected two single characters, got %q", line, text)
+		}
+		pairs = append(pairs, [2]string{fields[0], fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewConfusables(pairs)
+}
+
+// fold returns the folded character r stands for.
+func (c Confusables) fold(r rune) rune {
+	r = utils.Fold(r)
+	if to, ok := c[r]; ok {
+		return to
+	}
+	return r
+}
+
+func (c Confusables) foldAll(runes []rune) []rune {
+	if runes == nil {
+		return nil
+	}
+	folded := make([]rune, len(runes))
+	for i, r := range runes {
+		folded[i] = c.fold(r)
+	}
+	return folded
+}
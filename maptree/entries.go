@@ -0,0 +1,52 @@
+package maptree
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+)
+
+// Entries calls fn for every word in the tree that matches the filter, sorted by word.
+// the words are listed as their patterns spell them, the filter is matched against
+// them folded, with its prefix folded the same way.
+// it walks the list that was active when it was called, a reset in the meantime
+// does not change what is sent.
+func (t *Tree) Entries(filter matcher.Filter, fn func(matcher.Entry) error) error {
+	l := t.list.Load()
+	// spellings are the words as the patterns spell them, by the folded word
+	spellings := make(map[string]string, len(l.children)+len(l.expressions))
+	nodes := make(map[string]*Node, len(l.children)+len(l.expressions))
+	for word, node := range l.children {
+		spellings[word], nodes[word] = node.spelling, node
+	}
+	for text, e := range l.expressions {
+		// an expression is listed with the words it expands to, or with its text
+		// if it matches too many of them
+		words, err := e.term.expand(maxExplained)
+		if err != nil {
+			spellings[text], nodes[text] = e.node.spelling, e.node
+			continue
+		}
+		for _, spelling := range words {
+			word := string(l.confusables.foldAll(spelling))
+			if _, ok := nodes[word]; !ok {
+				spellings[word], nodes[word] = string(spelling), e.node
+			}
+		}
+	}
+	filter.Prefix = string(l.confusables.foldAll([]rune(filter.Prefix)))
+	var matched []string
+	for word := range nodes {
+		if filter.Match(word) {
+			matched = append(matched, word)
+		}
+	}
+	slices.SortFunc(matched, func(a, b string) int { return strings.Compare(spellings[a], spellings[b]) })
+	for _, word := range matched {
+		if err := fn(nodes[word].Entry(spellings[word])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package maptree
+
+import "github.com/mekavehamichlolay/bad-word-service/matcher"
+
+// SetExceptions replaces the exception phrases, the matches that fall entirely
+// inside an occurrence of one of them are dropped. the phrases are matched like
+// plain words, by the same automaton, so they cost no extra pass over the text.
+// they take effect at once, and are kept for the next Reset.
+func (t *Tree) SetExceptions(phrases []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.exceptions = phrases
+	l := t.list.Load().clone()
+	l.setExceptions(phrases)
+	t.list.Store(l.compile())
+}
+
+// PrepareExceptions replaces the exception phrases the next Reset is built with,
+// without changing the current list. a reload sets them right before its Reset,
+// so the list is compiled once.
+func (t *Tree) PrepareExceptions(phrases []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.exceptions = phrases
+}
+
+// setExceptions folds the phrases the way the text is folded before scanning.
+func (l *list) setExceptions(phrases []string) {
+	l.exceptions = make(map[string]*Node, len(phrases))
+	for _, phrase := range phrases {
+		folded := string(normalize(phrase, l.confusables).runes)
+		if folded != "" {
+			l.exceptions[folded] = &Node{Word: matcher.Word{Pattern: phrase}, exception: true}
+		}
+	}
+}
+
+// dropExceptions removes the matches that are inside one of the exception spans.
+func dropExceptions(matches []matcher.Match, exceptions [][2]uint) []matcher.Match {
+	result := matches[:0]
+matches:
+	for _, match := range matches {
+		for _, exception := range exceptions {
+			if exception[0] <= match.Start && match.End <= exception[1] {
+				continue matches
+			}
+		}
+		result = append(result, match)
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package maptree
+
+import (
+	"errors"
+	"slices"
+)
+
+// maxExplained is the most words Explain lists for a pattern.
+const maxExplained = 1000
+
+// Explanation tells how a pattern would be loaded, as it is sent on the "explain" socket.
+type Explanation struct {
+	Pattern string `json:"pattern"`
+	// Error is why the pattern can not be loaded. it has no column if the options are wrong
+	Error           *PatternError `json:"error,omitempty"`
+	StartOfWordOnly bool          `json:"startOfWordOnly"`
+	EndOfWordOnly   bool          `json:"endOfWordOnly"`
+	Options
+	// Words are the words the pattern stands for, as it spells them. the text is matched
+	// against them after the confusables are applied to both
+	Words []string `json:"words"`
+	// Unlisted is why Words is empty for a pattern that matches too many texts to list them
+	Unlisted string `json:"unlisted,omitempty"`
+	// Ignored is what of the options the pattern would be loaded without
+	Ignored string `json:"ignored,omitempty"`
+}
+
+// Explain parses a pattern the way a reload would, without changing the tree.
+func (t *Tree) Explain(pattern string, options Options) Explanation {
+	t.mutex.Lock()
+	l := newList(t.confusables)
+	t.mutex.Unlock()
+	result := Explanation{Pattern: pattern, Options: options}
+	ignored, err := l.addWord(0, []rune(pattern), nil, nil, options)
+	if err != nil {
+		if !errors.As(err, &result.Error) {
+			result.Error = &PatternError{Reason: err.Error()}
+		}
+		return result
+	}
+	result.Ignored = ignored
+	for _, node := range l.children {
+		result.Words = append(result.Words, node.spelling)
+		result.StartOfWordOnly, result.EndOfWordOnly = node.StartOfWordOnly, node.EndOfWordOnly
+	}
+	for _, e := range l.expressions {
+		result.StartOfWordOnly, result.EndOfWordOnly = e.node.StartOfWordOnly, e.node.EndOfWordOnly
+		words, err := e.term.expand(maxExplained)
+		if err != nil {
+			result.Unlisted = err.Error()
+			break
+		}
+		for _, word := range words {
+			result.Words = append(result.Words, string(word))
+		}
+	}
+	slices.Sort(result.Words)
+	result.Words = slices.Compact(result.Words)
+	return result
+}
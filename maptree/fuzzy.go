@@ -0,0 +1,194 @@
+package maptree
+
+import (
+	"slices"
+
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+	"github.com/mekavehamichlolay/bad-word-service/utils"
+)
+
+// MaxDistance is the biggest edit distance a word may allow.
+const MaxDistance = 2
+
+// maxDistanceFor is the biggest distance a word of length letters may allow, one
+// edit from six letters and two from nine. an edit turns a shorter word into too
+// many ordinary words, idiot into idiom and bad into bed.
+func maxDistanceFor(length int) int {
+	return min(max(length-3, 0)/3, MaxDistance)
+}
+
+// fuzzyTrie holds the words that allow an edit distance. it is searched with a
+// Levenshtein automaton, simulated one row per trie node, from every position of
+// the text where a word starts. a branch is left as soon as no word under it can
+// still be within its distance, so the search stays close to the exact one.
+type fuzzyTrie struct {
+	root      *fuzzyNode
+	maxLength int
+	// prefixes tells whether a word allows prefixes, so the search also starts after them
+	prefixes bool
+}
+
+type fuzzyNode struct {
+	children map[rune]*fuzzyNode
+	// words are the words that end in this node
+	words []*Node
+	// maxDistance is the biggest distance allowed by a word under this node
+	maxDistance int
+	depth       int
+}
+
+func newFuzzyNode(depth int) *fuzzyNode {
+	return &fuzzyNode{children: make(map[rune]*fuzzyNode), depth: depth}
+}
+
+// compileFuzzy builds the trie out of the words that allow an edit distance.
+// it returns nil if there are none.
+func compileFuzzy(children map[string]*Node) *fuzzyTrie {
+	f := &fuzzyTrie{root: newFuzzyNode(0)}
+	for word, node := range children {
+		if node.MaxDistance == 0 {
+			continue
+		}
+		cur := f.root
+		cur.maxDistance = max(cur.maxDistance, node.MaxDistance)
+		for _, char := range word {
+			next, ok := cur.children[char]
+			if !ok {
+				next = newFuzzyNode(cur.depth + 1)
+				cur.children[char] = next
+			}
+			cur = next
+			cur.maxDistance = max(cur.maxDistance, node.MaxDistance)
+		}
+		cur.words = append(cur.words, node)
+		f.prefixes = f.prefixes || node.AllowPrefixes
+		f.maxLength = max(f.maxLength, cur.depth)
+	}
+	if len(f.root.children) == 0 {
+		return nil
+	}
+	return f
+}
+
+// fuzzySearch is the search of the words that start at one position of the text.
+type fuzzySearch struct {
+	window []rune
+	// ends[j] tells whether window[:j] ends where a word of the text ends
+	ends []bool
+	// edge tells whether the window starts where a word of the text starts,
+	// the words that allow prefixes may also start after hebrew prefix letters
+	edge  bool
+	start int
+	found func(start, end, distance int, node *Node)
+}
+
+// search calls found for every text[start:end] that is within the distance of a word.
+// a misspelled word is only looked for as a whole word of the text, as a few edits
+// turn a part of an ordinary word into almost any short word. plain is the text
+// before the confusables were applied, for the word boundaries. for every word and
+// start only the closest end is reported.
+func (f *fuzzyTrie) search(text, plain []rune, found func(start, end, distance int, node *Node)) {
+	ends := make([]bool, len(text)+1)
+	for i := range ends {
+		ends[i] = i == len(text) || utils.IsEndOfWordSign(plain[i])
+	}
+	for start := range text {
+		if ends[start] {
+			continue
+		}
+		edge := start == 0 || ends[start-1]
+		if !edge && !(f.prefixes && matcher.OnlyPrefixesBefore(plain, start)) {
+			continue
+		}
+		s := fuzzySearch{edge: edge, start: start, found: found}
+		s.window = text[start:min(len(text), start+f.maxLength+MaxDistance)]
+		s.ends = ends[start : start+len(s.window)+1]
+		// row[j] is the distance between the path to the trie node and window[:j]
+		row := make([]int, len(s.window)+1)
+		for j := range row {
+			row[j] = j
+		}
+		for char, child := range f.root.children {
+			s.walk(child, char, row)
+		}
+	}
+}
+
+func (s *fuzzySearch) walk(node *fuzzyNode, char rune, previous []int) {
+	row := make([]int, len(previous))
+	row[0] = previous[0] + 1
+	best := row[0]
+	for j := 1; j < len(row); j++ {
+		substitution := previous[j-1]
+		if s.window[j-1] != char {
+			substitution++
+		}
+		row[j] = min(previous[j]+1, row[j-1]+1, substitution)
+		best = min(best, row[j])
+	}
+	for _, word := range node.words {
+		if !s.edge && !word.AllowPrefixes {
+			continue
+		}
+		end := -1
+		for j := 1; j < len(row); j++ {
+			if row[j] > word.MaxDistance || !s.ends[j] || utils.IsEndOfWordSign(s.window[j-1]) {
+				continue
+			}
+			// the closest end wins, on a tie the one as long as the word
+			if end == -1 || row[j] < row[end] || (row[j] == row[end] && abs(j-node.depth) < abs(end-node.depth)) {
+				end = j
+			}
+		}
+		if end != -1 {
+			s.found(s.start, s.start+end, row[end], word)
+		}
+	}
+	if best > node.maxDistance {
+		return
+	}
+	for next, child := range node.children {
+		s.walk(child, next, row)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// dropOverlappingFuzzy keeps, for every word that allows a distance, the closest
+// of its matches that overlap each other. a misspelled word is found from a few
+// starts around it, and only the best of them is wanted.
+func dropOverlappingFuzzy(matches []matcher.Match) []matcher.Match {
+	var fuzzy []matcher.Match
+	result := make([]matcher.Match, 0, len(matches))
+	for _, match := range matches {
+		if match.Word.MaxDistance == 0 {
+			result = append(result, match)
+		} else {
+			fuzzy = append(fuzzy, match)
+		}
+	}
+	slices.SortStableFunc(fuzzy, func(a, b matcher.Match) int {
+		if a.Distance != b.Distance {
+			return a.Distance - b.Distance
+		}
+		return int(b.End-b.Start) - int(a.End-a.Start)
+	})
+	// the variants of a pattern are different nodes, so they are told apart by the pattern
+	kept := make(map[string][]matcher.Match)
+fuzzy:
+	for _, match := range fuzzy {
+		for _, other := range kept[match.Word.Pattern] {
+			if match.Start < other.End && other.Start < match.End {
+				continue fuzzy
+			}
+		}
+		kept[match.Word.Pattern] = append(kept[match.Word.Pattern], match)
+		result = append(result, match)
+	}
+	return result
+}
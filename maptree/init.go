@@ -1,7 +1,45 @@
 package maptree
 
+import "database/sql"
+
 type badWord struct {
-	word          string
-	dontStartWith string
-	dontEndWith   string
+	id              int64
+	word            string
+	dontStartWith   string
+	dontEndWith     string
+	allowPrefixes   bool
+	allowSeparators bool
+	// collapseRepeats is null for the words that follow the default of the tree
+	collapseRepeats sql.NullBool
+	maxDistance     int
+	severity        int
+	category        string
+	replacement     string
+}
+
+// Options are the per word settings that are stored next to the word in mw_bad_words.
+// the zero value is the plain behavior.
+type Options struct {
+	// AllowPrefixes lets a start of word match follow any run of hebrew prefix letters,
+	// so ^word also matches ובword and שלword.
+	AllowPrefixes bool `json:"allowPrefixes"`
+	// AllowSeparators lets runs of separators appear between the letters,
+	// so bad also matches "b a d", b-a-d and b_a_d. a match with separators must start
+	// and end at word boundaries.
+	AllowSeparators bool `json:"allowSeparators"`
+	// CollapseRepeats lets every letter match a run of itself,
+	// so bad also matches baaaad and bbadd.
+	CollapseRepeats bool `json:"collapseRepeats"`
+	// MaxDistance is the number of edits, up to MaxDistance, a text may differ
+	// from the word by and still match it. the matches report their distance.
+	// a word allows one edit from six letters and two from nine, a bigger distance
+	// is lowered to that, and only whole words of the text match it. the words with a distance ignore AllowSeparators
+	// and CollapseRepeats.
+	MaxDistance int `json:"maxDistance"`
+	// Severity tells how offensive the word is, the higher the worse. zero is unset.
+	Severity int `json:"severity"`
+	// Category is the kind of the word, such as profanity, hate or spam. empty is unset.
+	Category string `json:"category"`
+	// Replacement is the text a match is masked with, when a request asks for the replacements.
+	Replacement string `json:"replacement"`
 }
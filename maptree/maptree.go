@@ -4,239 +4,377 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"maps"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
 	"github.com/mekavehamichlolay/bad-word-service/utils"
 )
 
+// Node is a word of the list, the Word the matches carry and what the list keeps about it.
 type Node struct {
-	DontStartWith, DontEndWith     []rune
-	EndOfWordOnly, StartOfWordOnly bool
+	matcher.Word
+	// spelling is the variant of the pattern the node was added for, as the pattern
+	// spells it, before the confusables are applied
+	spelling string
+	// exception marks the phrases of SetExceptions, they are found like words but never returned
+	exception bool
 }
+
+// list is one loaded version of the words. once a Tree publishes it, it is never
+// changed again, so scans read it without locking and a reload that fails halfway
+// is never seen.
+type list struct {
+	// children are the plain words, and the expansions of the patterns that allow a distance
+	children map[string]*Node
+	// expressions are the rest of the patterns, by their text without the anchors
+	expressions map[string]expression
+	// expanded are the folded words of the expressions that could be listed, so no
+	// word is loaded by a word and an expression both
+	expanded map[string]bool
+	// exceptions are the folded exception phrases
+	exceptions  map[string]*Node
+	sizes       []int
+	automatons  []*automaton
+	nfas        []*nfa
+	fuzzy       *fuzzyTrie
+	confusables Confusables
+}
+
 type Tree struct {
-	Children map[string]*Node
-	Sizes    []int
-	mutex    sync.RWMutex
+	list atomic.Pointer[list]
+	// mutex serializes the writers, the readers only load the current list
+	mutex sync.Mutex
+	// reload is held for the whole of a Reset, so a slower reload that read older
+	// rows never publishes its list over the one of a newer reload
+	reload sync.Mutex
+	// confusables is the table the next reload is built with
+	confusables Confusables
+	// collapseRepeats is the default of the words that do not set it themselves
+	collapseRepeats bool
+	// exceptions are the phrases the next reload is built with
+	exceptions []string
+	report     matcher.LoadReport
 }
 
 type TreeInterface interface {
-	AddWord(word []rune, dontStartWith []rune, dontFinishWith []rune) error
+	AddWord(word []rune, dontStartWith []rune, dontFinishWith []rune, options Options) error
 	HasWord(text string) [][2]uint
 	Has(word string) bool
-	Reset(ctx context.Context, conn *sql.Conn) error
+	Reset(ctx context.Context, conn *sql.Conn, query string) error
 	set(res *sql.Rows) error
 }
 
 func NewTree() *Tree {
-	return &Tree{Children: make(map[string]*Node)}
+	t := &Tree{confusables: DefaultConfusables()}
+	t.list.Store(newList(t.confusables).compile())
+	return t
 }
 
-func (t *Tree) AddWord(word []rune, dontStartWith []rune, dontFinishWith []rune) error {
-	if len(word) < 2 {
-		return fmt.Errorf("word length must be at least two characters")
-	}
-	startOfWordOnly := false
-	if word[0] == '^' {
-		startOfWordOnly = true
-		word = word[1:]
-		if len(word) < 2 {
-			return fmt.Errorf("word length must be at least two characters")
-		}
-	}
-	endNodes, err := add([][]rune{}, word)
-	if err != nil {
-		return err
+func newList(confusables Confusables) *list {
+	return &list{
+		children:    make(map[string]*Node),
+		expressions: make(map[string]expression),
+		expanded:    make(map[string]bool),
+		confusables: confusables,
 	}
+}
+
+// SetConfusables replaces the confusables table. the patterns are folded with it
+// when they are loaded, so it takes effect with the next Reset.
+func (t *Tree) SetConfusables(confusables Confusables) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	for _, node := range endNodes {
-		endOfWordOnly := node[len(node)-1] == ' '
-		if endOfWordOnly {
-			node = node[:len(node)-1]
-		}
-		if _, ok := t.Children[string(node)]; ok {
-			return fmt.Errorf("word already exists")
+	t.confusables = confusables
+}
+
+// SetCollapseRepeats sets whether the words that do not say otherwise in the
+// database match stretched letters, like baaad for bad. it takes effect with the next Reset.
+func (t *Tree) SetCollapseRepeats(collapse bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.collapseRepeats = collapse
+}
+
+// clone returns an uncompiled copy of the list that can be changed.
+func (l *list) clone() *list {
+	c := &list{
+		children:    make(map[string]*Node, len(l.children)),
+		expressions: make(map[string]expression, len(l.expressions)),
+		expanded:    maps.Clone(l.expanded),
+		exceptions:  l.exceptions,
+		sizes:       slices.Clone(l.sizes),
+		confusables: l.confusables,
+	}
+	for word, node := range l.children {
+		c.children[word] = node
+	}
+	for text, e := range l.expressions {
+		c.expressions[text] = e
+	}
+	return c
+}
+
+// compile builds the automatons of the list and returns it, ready to be published.
+func (l *list) compile() *list {
+	l.automatons, l.nfas = nil, nil
+	for _, separators := range []bool{false, true} {
+		for _, repeats := range []bool{false, true} {
+			if a := compile(l.children, l.exceptions, separators, repeats); a != nil {
+				l.automatons = append(l.automatons, a)
+			}
 		}
-		t.Children[string(node)] = &Node{
-			DontStartWith:   dontStartWith,
-			DontEndWith:     dontFinishWith,
-			EndOfWordOnly:   endOfWordOnly,
-			StartOfWordOnly: startOfWordOnly,
+		if m := compileNFA(l.expressions, separators, l.confusables); m != nil {
+			l.nfas = append(l.nfas, m)
 		}
-		t.SetSize(len(node))
 	}
+	l.fuzzy = compileFuzzy(l.children)
+	return l
+}
+
+// AddWord adds a single word to a copy of the current list and publishes it.
+// to load many words use Set, which publishes once.
+func (t *Tree) AddWord(word []rune, dontStartWith []rune, dontFinishWith []rune, options Options) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	l := t.list.Load().clone()
+	if _, err := l.addWord(0, word, dontStartWith, dontFinishWith, options); err != nil {
+		return err
+	}
+	t.list.Store(l.compile())
 	return nil
 }
 
-func add(words [][]rune, word []rune) ([][]rune, error) {
-	if len(word) == 0 {
-		return nil, fmt.Errorf("you passed an empty string")
+// maxExpansion is the most words a pattern that allows a distance may stand for,
+// as those are searched word by word.
+const maxExpansion = 256
+
+// addWord adds a pattern, id is its row in mw_bad_words or zero if it did not come from there.
+// a word too short for the distance of options is added with the biggest one it allows,
+// ignored then tells what the pattern was added without.
+func (l *list) addWord(id int64, word []rune, dontStartWith []rune, dontFinishWith []rune, options Options) (ignored string, err error) {
+	if options.MaxDistance < 0 || options.MaxDistance > MaxDistance {
+		return "", fmt.Errorf("the edit distance must be between 0 and %d", MaxDistance)
 	}
-	char := utils.ToLowerCase(word[0])
-	if utils.IsExpectedAsCharacter(char) {
-		for i := 0; i < len(words); i++ {
-			words[i] = append(words[i], char)
-		}
-		if len(words) == 0 {
-			words = append(words, []rune{char})
-		}
-		if len(word) == 1 {
-			return words, nil
-		}
-		return add(words, word[1:])
+	if options.Severity < 0 {
+		return "", fmt.Errorf("the severity can not be negative")
 	}
-	if char == '$' && len([]rune(word)) == 1 {
-		for i := 0; i < len(words); i++ {
-			words[i] = append(words[i], ' ')
+	parsed, err := parsePattern(string(word))
+	if err != nil {
+		return "", err
+	}
+	newNode := func(variant []rune, distance int) *Node {
+		return &Node{
+			Word: matcher.Word{
+				ID:              id,
+				Pattern:         string(word),
+				DontStartWith:   utils.FoldRunes(dontStartWith),
+				DontEndWith:     utils.FoldRunes(dontFinishWith),
+				EndOfWordOnly:   parsed.endOfWordOnly,
+				StartOfWordOnly: parsed.startOfWordOnly,
+				AllowPrefixes:   options.AllowPrefixes,
+				AllowSeparators: options.AllowSeparators,
+				CollapseRepeats: options.CollapseRepeats,
+				MaxDistance:     distance,
+				Severity:        options.Severity,
+				Category:        options.Category,
+				Replacement:     options.Replacement,
+			},
+			spelling: string(variant),
 		}
-		return words, nil
 	}
-	if char == '[' {
-		// multiple options
-		if len([]rune(word)) < 4 {
-			return nil, fmt.Errorf("it does not make sense to have less then 2 optional chararcters or a closing bracket and question mark")
+	literal, isLiteral := parsed.root.literal()
+	if !isLiteral && options.MaxDistance == 0 {
+		text := string(l.confusables.foldAll(parsed.text))
+		if _, ok := l.expressions[text]; ok {
+			return "", fmt.Errorf("word already exists")
 		}
-		word = word[1:]
-		var multiOptionChars []rune
-		for word[0] != ']' {
-			if len(word) < 2 {
-				return nil, fmt.Errorf("you have an open bracket without a closing bracket")
-			}
-			char = utils.ToLowerCase(word[0])
-			if !utils.IsExpectedAsCharacter(char) {
-				return nil, fmt.Errorf("you have a non character in the optional part %s", string(word))
+		// the words are checked against the other patterns, unless there are too many to list
+		var folded []string
+		if variants, err := parsed.root.expand(maxExplained); err == nil {
+			for _, variant := range variants {
+				node := l.confusables.foldAll(variant)
+				if options.AllowSeparators {
+					node = slices.DeleteFunc(node, utils.IsEndOfWordSign)
+				}
+				if _, ok := l.children[string(node)]; ok || l.expanded[string(node)] {
+					return "", fmt.Errorf("word already exists")
+				}
+				folded = append(folded, string(node))
 			}
-			multiOptionChars = append(multiOptionChars, char)
-			word = word[1:]
 		}
-		if len(multiOptionChars) < 2 && (len(word) < 2 || word[1] != '?') {
-			return nil, fmt.Errorf("you have less than 2 optional characters")
+		for _, word := range folded {
+			l.expanded[word] = true
 		}
-		if len(word) < 2 {
-			var newWords [][]rune
-			for i := 0; i < len(words); i++ {
-				for in := 0; in < len(multiOptionChars); in++ {
-					newWords = append(newWords, []rune(string(words[i])+string(multiOptionChars[in])))
-				}
-			}
-			return newWords, nil
+		l.expressions[text] = expression{term: parsed.root, node: newNode(parsed.text, 0)}
+		return "", nil
+	}
+	words := [][]rune{literal}
+	if !isLiteral {
+		// the fuzzy trie needs the words themselves
+		if words, err = parsed.root.expand(maxExpansion); err != nil {
+			return "", err
 		}
-		if word[1] == '?' && len(word) == 2 {
-			var newWords [][]rune
-			for i := 0; i < len(words); i++ {
-				for in := 0; in < len(multiOptionChars); in++ {
-					newWords = append(newWords, []rune(string(words[i])+string(multiOptionChars[in])))
-				}
-			}
-			words = append(words, newWords...)
-			return words, nil
+	}
+	// every variant is checked before any is added, so a pattern that fails leaves the list as it was
+	// added are the folded words, with the variants they were folded from
+	added := make(map[string][]rune, len(words))
+	for _, variant := range words {
+		node := l.confusables.foldAll(variant)
+		if options.AllowSeparators {
+			// the separators of the text are skipped, so the ones of the pattern are too
+			node = slices.DeleteFunc(node, utils.IsEndOfWordSign)
 		}
-		var newWords [][]rune
-		for i := 0; i < len(words); i++ {
-			for in := 0; in < len(multiOptionChars); in++ {
-				newWords = append(newWords, []rune(string(words[i])+string(multiOptionChars[in])))
-			}
+		if _, ok := added[string(node)]; ok {
+			// two variants of this pattern look the same once folded
+			continue
+		}
+		if _, ok := l.children[string(node)]; ok || l.expanded[string(node)] {
+			return "", fmt.Errorf("word already exists")
 		}
-		if word[1] == '?' {
-			words = append(words, newWords...)
-			word = word[2:]
-		} else {
-			words = newWords
-			word = word[1:]
+		if length := len(node); options.MaxDistance > maxDistanceFor(length) && ignored == "" {
+			ignored = fmt.Sprintf("the edit distance is lowered to %d, the most a word of %d letters allows", maxDistanceFor(length), length)
 		}
-		return add(words, word)
+		added[string(node)] = variant
+	}
+	for node, variant := range added {
+		length := len([]rune(node))
+		l.children[node] = newNode(variant, min(options.MaxDistance, maxDistanceFor(length)))
+		l.setSize(length)
 	}
-	return nil, fmt.Errorf("you have a non character in the optional part %s", string(word))
+	return ignored, nil
 }
 
-func (t *Tree) SetSize(size int) {
-	// dont lock. if where here its already locked
-	for i := 0; i < len(t.Sizes); i++ {
-		if t.Sizes[i] == size {
+func (l *list) setSize(size int) {
+	for i := 0; i < len(l.sizes); i++ {
+		if l.sizes[i] == size {
 			return
 		}
 	}
-	t.Sizes = append(t.Sizes, size)
+	l.sizes = append(l.sizes, size)
 }
+
 func (t *Tree) HasWord(text string) [][2]uint {
-	var result [][2]uint
-	runeText := []rune(text)
-	t.mutex.RLock()
-	for _, length := range t.Sizes {
-	wordWalker:
-		for i := 0; i < len(runeText)-length; i++ {
-			word := string(runeText[i : i+length])
-			if node, ok := t.Children[word]; ok {
-				if node.StartOfWordOnly {
-					if i != 0 && !isStartOrEndOfWord(runeText[i-1]) {
-						continue wordWalker
-					}
-				}
-				if node.EndOfWordOnly {
-					if i+length+1 < len(runeText) && !isStartOrEndOfWord(runeText[i+length]) {
-						continue wordWalker
-					}
-				}
-				if node.DontStartWith != nil && i != 0 {
-					for _, c := range node.DontStartWith {
-						if runeText[i-1] == c {
-							continue wordWalker
-						}
-					}
-				}
-				if node.DontEndWith != nil && i+length+1 != len(runeText) {
-					for _, c := range node.DontEndWith {
-						if runeText[i+length] == c {
-							continue wordWalker
-						}
-					}
-				}
-				result = append(result, [2]uint{uint(i), uint(i + length)})
-			}
+	matches := t.Matches(text)
+	if len(matches) == 0 {
+		return nil
+	}
+	result := make([][2]uint, 0, len(matches))
+	for _, match := range matches {
+		// two patterns that match the same text, like an expression too big to check
+		// against the words, are one pair
+		if span := [2]uint{match.Start, match.End}; len(result) == 0 || result[len(result)-1] != span {
+			result = append(result, span)
+		}
+	}
+	return result
+}
+
+// Matches returns the words found in text, sorted by their start and end.
+func (t *Tree) Matches(text string) []matcher.Match {
+	var result []matcher.Match
+	var exceptions [][2]uint
+	l := t.list.Load()
+	normal := normalize(text, l.confusables)
+	l.scan(normal.runes, normal.plain, func(start, end, distance int, node *Node) {
+		if node.exception {
+			exceptions = append(exceptions, normal.span(start, end))
+		} else if node.Allowed(normal.plain, start, end) && (!node.AllowSeparators || spacedOut(normal.plain, start, end)) {
+			span := normal.span(start, end)
+			result = append(result, matcher.Match{Start: span[0], End: span[1], Distance: distance, Word: &node.Word})
 		}
+	})
+	if len(exceptions) > 0 {
+		result = dropExceptions(result, exceptions)
+	}
+	if l.fuzzy != nil {
+		result = dropOverlappingFuzzy(result)
 	}
-	t.mutex.RUnlock()
-	slices.SortStableFunc(result, func(a, b [2]uint) int {
-		return int(a[0]) - int(b[0])
+	slices.SortStableFunc(result, func(a, b matcher.Match) int {
+		if a.Start != b.Start {
+			return int(a.Start) - int(b.Start)
+		}
+		return int(a.End) - int(b.End)
 	})
 	return result
 }
-func isStartOrEndOfWord(c rune) bool {
-	switch c {
-	case ' ', '\n', '\t', '\r', '|', '!', '?', '.', ',', ';', ':', '(', ')', '[', ']', '{', '}', '<', '>', '/', '\\', '%', '@', '&', '*', '^', '+', '-', '_', '=', '~', '`':
+
+// spacedOut reports whether text[start:end] may be a word that allows separators.
+// a match with separators in it must start and end at word boundaries, so the letters
+// of ordinary words around a space, like "as s" in "has seen", are not read as one.
+func spacedOut(text []rune, start, end int) bool {
+	if !slices.ContainsFunc(text[start:end], utils.IsEndOfWordSign) {
 		return true
 	}
-	return false
+	return (start == 0 || utils.IsEndOfWordSign(text[start-1])) && (end == len(text) || utils.IsEndOfWordSign(text[end]))
 }
 
+// Has reports whether word is in the list. word is folded the way a text is,
+// and a pattern has it if it matches all of it.
 func (t *Tree) Has(word string) bool {
-	t.mutex.RLock()
-	defer t.mutex.RUnlock()
-	_, ok := t.Children[word]
-	return ok
+	l := t.list.Load()
+	normal := normalize(word, l.confusables)
+	if _, ok := l.children[string(normal.runes)]; ok {
+		return true
+	}
+	joined := slices.DeleteFunc(slices.Clone(normal.runes), utils.IsEndOfWordSign)
+	if node, ok := l.children[string(joined)]; ok && node.AllowSeparators {
+		return true
+	}
+	found := false
+	for _, m := range l.nfas {
+		m.search(normal.runes, normal.plain, func(start, end int, node *Node) {
+			found = found || (start == 0 && end == len(normal.runes))
+		})
+	}
+	return found
+}
+
+// Len returns the number of words in the current list, a pattern that allows
+// a distance is counted once for every word it expands to.
+func (t *Tree) Len() int {
+	l := t.list.Load()
+	return len(l.children) + len(l.expressions)
 }
 
-func (tree *Tree) Reset(ctx context.Context, conn *sql.Conn) error {
+// Reset loads the words returned by query, which must select the id, the word,
+// the dont start with, the dont end with, the allow prefixes, the allow separators,
+// the collapse repeats, the max distance, the severity, the category and the replacement
+// columns of mw_bad_words.
+// collapse repeats may be null.
+// the new list is built aside and replaces the current one once all the rows were read,
+// the reloads run one at a time.
+// a row that can not be loaded is skipped and listed in the Report, if the query
+// fails or no row loaded the current list stays active.
+func (tree *Tree) Reset(ctx context.Context, conn *sql.Conn, query string) error {
 	defer conn.Close()
-	rows, err := conn.QueryContext(ctx, "SELECT bw_word, bw_dont_start_with, bw_dont_end_with FROM mw_bad_words")
+	tree.reload.Lock()
+	defer tree.reload.Unlock()
+	rows, err := conn.QueryContext(ctx, query)
 	if err != nil {
+		tree.fail(matcher.LoadReport{Time: time.Now()}, err)
 		return err
 	}
 	defer rows.Close()
-	if err := tree.set(rows); err != nil {
-		return err
-	}
-	return nil
+	return tree.set(rows)
 }
 
+// Set adds the words to the current list. the words that failed are reported
+// in the error, the rest are published together.
 func (t *Tree) Set(words [][3][]rune) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	l := t.list.Load().clone()
 	var errores []error = make([]error, 0)
 	for _, word := range words {
-		if err := t.AddWord(word[0], word[1], word[2]); err != nil {
+		if _, err := l.addWord(0, word[0], word[1], word[2], Options{}); err != nil {
 			errores = append(errores, err)
 		}
 	}
+	t.list.Store(l.compile())
 	if len(errores) > 0 {
 		return fmt.Errorf("errors: %v", errores)
 	}
@@ -245,25 +383,64 @@ func (t *Tree) Set(words [][3][]rune) error {
 
 func (t *Tree) set(res *sql.Rows) error {
 	t.mutex.Lock()
-	t.Children = nil
-	t.Sizes = nil
-	t.Children = make(map[string]*Node)
-	t.Sizes = make([]int, 0)
+	l := newList(t.confusables)
+	l.setExceptions(t.exceptions)
+	collapseRepeats := t.collapseRepeats
 	t.mutex.Unlock()
+	report := matcher.LoadReport{Time: time.Now(), Skipped: []matcher.RowError{}}
 	for res.Next() {
 		var bw badWord
-		if err := res.Scan(&bw.word, &bw.dontStartWith, &bw.dontEndWith); err != nil {
-			return err
+		if err := res.Scan(&bw.id, &bw.word, &bw.dontStartWith, &bw.dontEndWith, &bw.allowPrefixes, &bw.allowSeparators,
+			&bw.collapseRepeats, &bw.maxDistance, &bw.severity, &bw.category, &bw.replacement); err != nil {
+			report.Skipped = append(report.Skipped, matcher.RowError{ID: bw.id, Pattern: bw.word, Error: err.Error()})
+			continue
+		}
+		options := Options{
+			AllowPrefixes:   bw.allowPrefixes,
+			AllowSeparators: bw.allowSeparators,
+			CollapseRepeats: collapseRepeats,
+			MaxDistance:     bw.maxDistance,
+			Severity:        bw.severity,
+			Category:        bw.category,
+			Replacement:     bw.replacement,
+		}
+		if bw.collapseRepeats.Valid {
+			options.CollapseRepeats = bw.collapseRepeats.Bool
 		}
-		if err := t.AddWord([]rune(bw.word), []rune(bw.dontStartWith), []rune(bw.dontEndWith)); err != nil {
-			return err
+		ignored, err := l.addWord(bw.id, []rune(bw.word), []rune(bw.dontStartWith), []rune(bw.dontEndWith), options)
+		if err != nil {
+			report.Skipped = append(report.Skipped, matcher.RowError{ID: bw.id, Pattern: bw.word, Error: err.Error()})
+		} else if ignored != "" {
+			report.Ignored = append(report.Ignored, matcher.RowError{ID: bw.id, Pattern: bw.word, Error: ignored})
 		}
 	}
 	if err := res.Close(); err != nil {
-		return err
+		return t.fail(report, err)
 	}
 	if err := res.Err(); err != nil {
-		return err
+		return t.fail(report, err)
+	}
+	if len(l.children) == 0 && len(l.expressions) == 0 {
+		return t.fail(report, fmt.Errorf("the database returned no words, keeping the current list"))
 	}
+	l.compile()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.list.Store(l)
+	report.Words = t.Len()
+	t.report = report
 	return nil
 }
+
+// fail records a reload that did not replace the list, and returns err.
+func (t *Tree) fail(report matcher.LoadReport, err error) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	report.Words = t.Len()
+	report.Error = err.Error()
+	if report.Skipped == nil {
+		report.Skipped = []matcher.RowError{}
+	}
+	t.report = report
+	return err
+}
@@ -0,0 +1,613 @@
+package maptree
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+)
+
+// mapScan is the window scan HasWord used before the automaton, kept to
+// check the automaton against it and to benchmark the two. the expressions
+// are expanded the way add used to, to check the nfa too.
+func mapScan(tb testing.TB, t *Tree, text string) [][2]uint {
+	var result [][2]uint
+	l := t.list.Load()
+	words, sizes := l.children, l.sizes
+	if len(l.expressions) > 0 {
+		words, sizes = maps.Clone(l.children), slices.Clone(l.sizes)
+		for _, e := range l.expressions {
+			expanded, err := e.term.expand(1000)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			for _, word := range expanded {
+				words[string(l.confusables.foldAll(word))] = e.node
+				if !slices.Contains(sizes, len(word)) {
+					sizes = append(sizes, len(word))
+				}
+			}
+		}
+	}
+	normal := normalize(text, l.confusables)
+	for _, length := range sizes {
+		for i := 0; i+length <= len(normal.runes); i++ {
+			if node, ok := words[string(normal.runes[i:i+length])]; ok && node.Allowed(normal.plain, i, i+length) {
+				result = append(result, normal.span(i, i+length))
+			}
+		}
+	}
+	slices.SortStableFunc(result, func(a, b [2]uint) int {
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		return int(a[1]) - int(b[1])
+	})
+	return result
+}
+
+func testTree(tb testing.TB) *Tree {
+	tree := NewTree()
+	words := [][3][]rune{
+		{[]rune("bad"), nil, nil},
+		{[]rune("badword"), nil, nil},
+		{[]rune("^start"), nil, nil},
+		{[]rune("end$"), nil, nil},
+		{[]rune("z[ab]?cd"), []rune("x"), []rune("y")},
+		{[]rune("מילה"), nil, nil},
+		{[]rune("^רע[הו]$"), nil, nil},
+		{[]rune("שמנ$"), nil, nil},
+		{[]rune("כלבך"), nil, nil},
+		{[]rune("רָשָׁע"), nil, nil},
+	}
+	if err := tree.Set(words); err != nil {
+		tb.Fatal(err)
+	}
+	return tree
+}
+
+func TestHasWord(t *testing.T) {
+	tree := testTree(t)
+	tests := []struct {
+		text string
+		want [][2]uint
+	}{
+		{"", nil},
+		{"bad", [][2]uint{{0, 3}}},
+		{"a badword", [][2]uint{{2, 5}, {2, 9}}},
+		{"restart start", [][2]uint{{8, 13}}},
+		{"endless end", [][2]uint{{8, 11}}},
+		{"xzcd zacd zcdy zbcd", [][2]uint{{5, 9}, {15, 19}}},
+		{"זו מילה רעה", [][2]uint{{3, 7}, {8, 11}}},
+		{"ורעה", nil},
+		{"Bad", [][2]uint{{0, 3}}},
+		{"שמן שמנה", [][2]uint{{0, 3}}},
+		{"כלבכם", [][2]uint{{0, 4}}},
+		{"זו מִילָּה", [][2]uint{{3, 10}}},
+		{"רשע־מִלָּה", [][2]uint{{0, 3}}},
+		{"a b\u200dad", [][2]uint{{2, 6}}},
+		{"ba\u00add", [][2]uint{{0, 4}}},
+		{"ｂａｄ", [][2]uint{{0, 3}}},
+		{"מי\u200fלה", [][2]uint{{0, 5}}},
+		{"ר\ufb2aע", [][2]uint{{0, 3}}},
+		{"b@d", nil},
+		{"bаd", [][2]uint{{0, 3}}},
+		{"the end!", [][2]uint{{4, 7}}},
+		{"the 3nd.", nil},
+	}
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.want)
+		}
+		if got := mapScan(t, tree, test.text); !slices.Equal(got, test.want) {
+			t.Errorf("mapScan(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestHas(t *testing.T) {
+	tree := testTree(t)
+	for _, word := range []string{"nazi", "a(b|c)d"} {
+		if err := tree.AddWord([]rune(word), nil, nil, Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.AddWord([]rune("spam"), nil, nil, Options{AllowSeparators: true}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{"bad", true},
+		{"BAD", true},
+		{"כלבך", true},
+		{"כלבכ", true},
+		{"מִילָה", true},
+		{"nazi", true},
+		{"abd", true},
+		{"acd", true},
+		{"abcd", false},
+		{"ab", false},
+		{"s-p-a-m", true},
+		{"b-a-d", false},
+		{"badw", false},
+	}
+	for _, test := range tests {
+		if got := tree.Has(test.word); got != test.want {
+			t.Errorf("Has(%q) = %v, want %v", test.word, got, test.want)
+		}
+	}
+}
+
+func benchmarkText() string {
+	return strings.Repeat("זהו טקסט ארוך של דף ויקי עם מילה רעה ועוד a badword or two, and the end. ", 500)
+}
+
+func BenchmarkHasWordAutomaton(b *testing.B) {
+	tree := testTree(b)
+	text := benchmarkText()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.HasWord(text)
+	}
+}
+
+func BenchmarkHasWordMapScan(b *testing.B) {
+	tree := testTree(b)
+	text := benchmarkText()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mapScan(b, tree, text)
+	}
+}
+
+func TestAllowPrefixes(t *testing.T) {
+	tree := NewTree()
+	if err := tree.AddWord([]rune("^מילה"), nil, nil, Options{AllowPrefixes: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("^רע"), nil, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want [][2]uint
+	}{
+		{"מילה", [][2]uint{{0, 4}}},
+		{"והמילה", [][2]uint{{2, 6}}},
+		{"וכשמהמילה", [][2]uint{{5, 9}}},
+		{"אמילה", nil},
+		{"אבהמילה", nil},
+		{"ורע", nil},
+	}
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestLoadConfusables(t *testing.T) {
+	confusables, err := LoadConfusables(strings.NewReader("# digits\n0 o\n\nO ס\nk ק\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := NewTree()
+	tree.SetConfusables(confusables)
+	l := newList(tree.confusables)
+	if _, err := l.addWord(0, []rune("סוק"), nil, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	tree.list.Store(l.compile())
+	want := [][2]uint{{0, 3}}
+	for _, text := range []string{"סוק", "0וk", "oוק"} {
+		if got := tree.HasWord(text); !slices.Equal(got, want) {
+			t.Errorf("HasWord(%q) = %v, want %v", text, got, want)
+		}
+	}
+	if _, err := LoadConfusables(strings.NewReader("ab c\n")); err == nil {
+		t.Error("LoadConfusables() with a bad line did not fail")
+	}
+}
+
+func TestLeetspeak(t *testing.T) {
+	newTree := func(confusables Confusables) *Tree {
+		tree := NewTree()
+		tree.SetConfusables(confusables)
+		tree.list.Store(newList(confusables).compile())
+		for _, word := range []string{"bad", "end$", "nazi", "hi", "sh[i1]t", "s1n"} {
+			if err := tree.AddWord([]rune(word), nil, nil, Options{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return tree
+	}
+	tree := newTree(DefaultConfusables())
+	tests := []struct {
+		text      string
+		plain     [][2]uint
+		leetspeak [][2]uint
+	}{
+		{"b@d", nil, [][2]uint{{0, 3}}},
+		{"the 3nd.", nil, [][2]uint{{4, 7}}},
+		{"s!n", nil, [][2]uint{{0, 3}}},
+		// the boundaries are checked before the confusables, a ! still ends a word
+		{"the 3nd!", nil, [][2]uint{{4, 7}}},
+		{"n4zi", nil, [][2]uint{{0, 4}}},
+		{"nаzi", [][2]uint{{0, 4}}, [][2]uint{{0, 4}}},
+		// without the leetspeak the punctuation and the latin letters stay themselves
+		{"oh! ok", nil, [][2]uint{{1, 3}}},
+		{"ok nazi", [][2]uint{{3, 7}}, [][2]uint{{3, 7}}},
+		{"ok הazi", nil, nil},
+	}
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.plain) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.plain)
+		}
+	}
+	tree = newTree(LeetspeakConfusables())
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.leetspeak) {
+			t.Errorf("leetspeak HasWord(%q) = %v, want %v", test.text, got, test.leetspeak)
+		}
+	}
+	// the words are listed as they are spelled, and the prefix is folded like them
+	for prefix, want := range map[string][]string{"na": {"nazi"}, "$h": {"shit"}, "s1": {"s1n"}, "si": {"s1n"}} {
+		var got []string
+		if err := tree.Entries(matcher.Filter{Prefix: prefix}, func(entry matcher.Entry) error {
+			got = append(got, entry.Word)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Entries(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestAllowSeparators(t *testing.T) {
+	tree := NewTree()
+	if err := tree.AddWord([]rune("^badword$"), nil, nil, Options{AllowSeparators: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("בד"), nil, nil, Options{AllowSeparators: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("ass"), nil, nil, Options{AllowSeparators: true}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want [][2]uint
+	}{
+		{"a badword.", [][2]uint{{2, 9}}},
+		{"a b a d w o r d", [][2]uint{{2, 15}}},
+		{"b-a-d__word!", [][2]uint{{0, 11}}},
+		{"b.a.d.w.o.r.ds", nil},
+		{"ב-ד ב - - ד", [][2]uint{{0, 3}, {4, 11}}},
+		// the separators are only skipped in a span that starts and ends at word boundaries
+		{"he has seen it", nil},
+		{"as seen", nil},
+		{"a s s!", [][2]uint{{0, 5}}},
+		{"a bass", [][2]uint{{3, 6}}},
+	}
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestCollapseRepeats(t *testing.T) {
+	tree := NewTree()
+	if err := tree.AddWord([]rune("^bad$"), nil, nil, Options{CollapseRepeats: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("good"), nil, nil, Options{CollapseRepeats: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("רע"), nil, nil, Options{CollapseRepeats: true, AllowSeparators: true}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want [][2]uint
+	}{
+		{"bad", [][2]uint{{0, 3}}},
+		{"so baaaaaad!", [][2]uint{{3, 11}}},
+		{"bbaadd", [][2]uint{{0, 6}}},
+		{"god goooood", [][2]uint{{4, 11}}},
+		{"רררע ע", [][2]uint{{0, 6}}},
+	}
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestMaxDistance(t *testing.T) {
+	tree := NewTree()
+	for word, distance := range map[string]int{"stupid": 1, "^מטומטם": 1, "dumbasses": 2, "bastard": 1} {
+		if err := tree.AddWord([]rune(word), nil, nil, Options{MaxDistance: distance}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.AddWord([]rune("^מסריחים"), nil, nil, Options{MaxDistance: 1, AllowPrefixes: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("word"), nil, nil, Options{MaxDistance: 3}); err == nil {
+		t.Errorf("AddWord() with a distance of 3 did not fail")
+	}
+	// the shorter words are added with the distance they allow
+	for word, distance := range map[string]int{"bad": 1, "idiot": 1, "asshole": 2} {
+		if err := tree.AddWord([]rune(word), nil, nil, Options{MaxDistance: distance}); err != nil {
+			t.Errorf("AddWord(%q) with a distance of %d = %v", word, distance, err)
+		}
+	}
+	type match struct {
+		start, end uint
+		distance   int
+	}
+	tests := []struct {
+		text string
+		want []match
+	}{
+		{"you stupid", []match{{4, 10, 0}}},
+		{"you stupidd!", []match{{4, 11, 1}}},
+		{"you stupd.", []match{{4, 9, 1}}},
+		{"you stupids", []match{{4, 11, 1}}},
+		{"אתה מתומטם", []match{{4, 10, 1}}},
+		{"dunbases", []match{{0, 8, 2}}},
+		// the ordinary words that share a part with a word are left alone
+		{"a studio", nil},
+		{"stupidity", nil},
+		{"unstupid", nil},
+		{"the bastion", nil},
+		{"bastardization", nil},
+		{"the stupid-ish", []match{{4, 10, 0}}},
+		{"והמסריכים", []match{{2, 9, 1}}},
+		{"אמסריכים", nil},
+		{"אתה מסובך", nil},
+		{"you idiot", []match{{4, 9, 0}}},
+		{"an idiom", nil},
+		{"a bed", nil},
+		{"an assh0le", []match{{3, 10, 1}}},
+		{"an azzhole", nil},
+	}
+	for _, test := range tests {
+		var got []match
+		for _, m := range tree.Matches(test.text) {
+			got = append(got, match{m.Start, m.End, m.Distance})
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Matches(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	tree := NewTree()
+	for _, word := range []struct {
+		pattern string
+		options Options
+	}{
+		{"^ba{2,3}d$", Options{}},
+		{"(dumb|stupid)ass", Options{}},
+		{"^f[^a]ck", Options{}},
+		{"^\\d{3}word$", Options{}},
+		{"^\\hזז$", Options{}},
+		{"^a\\$\\$", Options{}},
+		{"^n[o0]{2,}b", Options{}},
+		{"^(ab|cd)x$", Options{CollapseRepeats: true}},
+		{"^q[ab]z$", Options{AllowSeparators: true}},
+		{"^jer(k|q)ing", Options{MaxDistance: 1}},
+	} {
+		err := tree.AddWord([]rune(word.pattern), nil, nil, word.options)
+		if word.pattern == "^n[o0]{2,}b" {
+			var perr *PatternError
+			if !errors.As(err, &perr) || perr.Column != 10 {
+				t.Errorf("AddWord(%q) = %v, want an error at column 10", word.pattern, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("AddWord(%q) = %v", word.pattern, err)
+		}
+	}
+	tests := []struct {
+		text string
+		want [][2]uint
+	}{
+		{"bad baad baaad baaaad", [][2]uint{{4, 8}, {9, 14}}},
+		{"a dumbass and a stupidass", [][2]uint{{2, 9}, {16, 25}}},
+		{"fuck fack", [][2]uint{{0, 4}}},
+		{"123word 12word", [][2]uint{{0, 7}}},
+		{"אזז", [][2]uint{{0, 3}}},
+		{"a$$", [][2]uint{{0, 3}}},
+		{"as$", nil},
+		{"aabbx cccdddxx abx ax", [][2]uint{{0, 5}, {6, 14}, {15, 18}}},
+		{"q.b-z", [][2]uint{{0, 5}}},
+		{"jerqing jirking", [][2]uint{{0, 7}, {8, 15}}},
+		{"jerk jirk", nil},
+	}
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tree := NewTree()
+	for _, word := range []string{"bad", "b[iu]g$"} {
+		if err := tree.AddWord([]rune(word), nil, nil, Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a word is loaded once, whether by a word or by an expression
+	for _, word := range []string{"b[ae]d$", "bug", "(big|bog)", "BAD"} {
+		if err := tree.AddWord([]rune(word), nil, nil, Options{}); err == nil {
+			t.Errorf("AddWord(%q) of a word that exists did not fail", word)
+		}
+	}
+	if err := tree.AddWord([]rune("b[^x]d"), nil, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.HasWord("bed bad bug"), [][2]uint{{0, 3}, {4, 7}, {8, 11}}; !slices.Equal(got, want) {
+		t.Errorf("HasWord() = %v, want %v", got, want)
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		column  int
+	}{
+		{"a", 2},
+		{"ab[cd", 3},
+		{"a[b]c", 2},
+		{"ab(cd", 3},
+		{"abc)d", 4},
+		{"a|", 3},
+		{"ab^c", 3},
+		{"a$bc", 2},
+		{"a?", 3},
+		{"ab?", 4},
+		{"(a|bc)d?", 9},
+		{"\\d{1,2}", 8},
+		{"[ab]?c", 7},
+		{"ab{3,2}", 3},
+		{"ab{1,99}", 3},
+		{"ab\\q", 4},
+		{"?ab", 1},
+		{"אָב{x}", 5},
+	}
+	for _, test := range tests {
+		_, err := parsePattern(test.pattern)
+		var perr *PatternError
+		if !errors.As(err, &perr) || perr.Column != test.column {
+			t.Errorf("parsePattern(%q) = %v, want an error at column %d", test.pattern, err, test.column)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	tree := NewTree()
+	tests := []struct {
+		pattern  string
+		options  Options
+		words    []string
+		column   int
+		unlisted bool
+	}{
+		{pattern: "^b[a4]d$", words: []string{"b4d", "bad"}},
+		{pattern: "(ab|cd)e?", words: []string{"ab", "abe", "cd", "cde"}},
+		{pattern: "b-ad", options: Options{AllowSeparators: true}, words: []string{"b-ad"}},
+		{pattern: "Nazi", words: []string{"Nazi"}},
+		{pattern: "b[^a]d", unlisted: true},
+		{pattern: "[a]", column: 1},
+		{pattern: "ab[cd", column: 3},
+		{pattern: "abc", options: Options{MaxDistance: 5}},
+	}
+	for _, test := range tests {
+		got := tree.Explain(test.pattern, test.options)
+		if test.column != 0 || test.options.MaxDistance > MaxDistance {
+			if got.Error == nil || got.Error.Column != test.column {
+				t.Errorf("Explain(%q).Error = %v, want an error at column %d", test.pattern, got.Error, test.column)
+			}
+			continue
+		}
+		if got.Error != nil {
+			t.Errorf("Explain(%q).Error = %v", test.pattern, got.Error)
+		}
+		if !slices.Equal(got.Words, test.words) || (got.Unlisted != "") != test.unlisted {
+			t.Errorf("Explain(%q) = %v %q, want %v", test.pattern, got.Words, got.Unlisted, test.words)
+		}
+	}
+	if got := tree.Explain("idiot", Options{MaxDistance: 1}); got.Error != nil || got.Ignored == "" {
+		t.Errorf("Explain(idiot) = %+v, want the distance ignored", got)
+	}
+	if got := tree.Explain("^bad$", Options{}); !got.StartOfWordOnly || !got.EndOfWordOnly {
+		t.Errorf("Explain(^bad$) = %+v, want both anchors", got)
+	}
+	if tree.Len() != 0 {
+		t.Errorf("Explain() changed the tree")
+	}
+}
+
+func TestSeverityAndCategory(t *testing.T) {
+	tree := NewTree()
+	if err := tree.AddWord([]rune("bad"), nil, nil, Options{Severity: 1, Category: "profanity"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("b[ae]st"), nil, nil, Options{Severity: 3, Category: "hate"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.AddWord([]rune("word"), nil, nil, Options{Severity: -1}); err == nil {
+		t.Error("AddWord() with a negative severity did not fail")
+	}
+	var got []string
+	for _, m := range tree.Matches("bad best") {
+		got = append(got, fmt.Sprintf("%d %s", m.Word.Severity, m.Word.Category))
+	}
+	if want := []string{"1 profanity", "3 hate"}; !slices.Equal(got, want) {
+		t.Errorf("Matches() = %v, want %v", got, want)
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tree := NewTree()
+	for _, word := range []string{"cunt", "ass", "b[ae]d"} {
+		if err := tree.AddWord([]rune(word), nil, nil, Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.AddWord([]rune("bastard"), nil, nil, Options{MaxDistance: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tree.SetExceptions([]string{"Scunthorpe", "class", "bad debt", "bustard", "ass"})
+	tests := []struct {
+		text string
+		want [][2]uint
+	}{
+		{"Scunthorpe cunt", [][2]uint{{11, 15}}},
+		{"SCUNTHORPE", nil},
+		{"first class ass", nil},
+		{"a bad debt and a bad deal", [][2]uint{{17, 20}}},
+		{"a bustard", nil},
+		{"a bastards", [][2]uint{{2, 10}}},
+		{"classy sass", nil},
+	}
+	for _, test := range tests {
+		if got := tree.HasWord(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+	// the exceptions stay after a word is added
+	if err := tree.AddWord([]rune("deal"), nil, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.HasWord("a bad debt, a deal"), [][2]uint{{14, 18}}; !slices.Equal(got, want) {
+		t.Errorf("HasWord() after AddWord = %v, want %v", got, want)
+	}
+}
+
+func TestMatchOffsets(t *testing.T) {
+	// the positions of Matches convert to the ones the callers slice with
+	tree := testTree(t)
+	text := "😀 זו מילה רעה"
+	offsets := matcher.NewOffsets(text, matcher.OffsetBytes)
+	for _, match := range tree.Matches(text) {
+		start, end := offsets.Convert(match.Start), offsets.Convert(match.End)
+		if got, want := text[start:end], string([]rune(text)[match.Start:match.End]); got != want {
+			t.Errorf("text[%d:%d] = %q, want %q", start, end, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package maptree
+
+import "github.com/mekavehamichlolay/bad-word-service/utils"
+
+// expression is a pattern that is not a plain word, kept parsed so it is matched
+// as it is instead of being expanded into every word it stands for.
+type expression struct {
+	term *term
+	node *Node
+}
+
+// nfa matches the expressions of a list. it is a Thompson automaton simulated
+// for all of them at once, with a thread for every state and start position, so
+// a class or a repetition costs a few states and never multiplies the words.
+type nfa struct {
+	states []nfaState
+	// firsts are the states that read the first rune of an expression
+	firsts     []int32
+	separators bool
+}
+
+// nfaState is one of three kinds. a state with a class reads a rune that matches it
+// and goes on to out, a state with a node accepts, and the rest go on to out and
+// alt without reading.
+type nfaState struct {
+	class *charClass
+	// loop lets the class read a run of the rune it read, for the words that collapse repeats
+	loop     bool
+	out, alt int32
+	node     *Node
+}
+
+// thread is a partial match that started at start. a thread with repeat set
+// is in the middle of a run, and only reads more of the same rune.
+type thread struct {
+	state  int32
+	start  int
+	repeat rune
+}
+
+// compileNFA builds the automaton out of the expressions that have the given
+// separators option. it returns nil if there are none.
+func compileNFA(expressions map[string]expression, separators bool, confusables Confusables) *nfa {
+	m := &nfa{separators: separators}
+	var starts []int32
+	for _, e := range expressions {
+		if e.node.AllowSeparators != separators {
+			continue
+		}
+		accept := m.add(nfaState{out: -1, alt: -1, node: e.node})
+		starts = append(starts, m.build(e.term, accept, e.node.CollapseRepeats, confusables))
+	}
+	if len(starts) == 0 {
+		return nil
+	}
+	// a thread is only started where its first rune matches, so the states
+	// that do not read are followed once here instead of at every position
+	v := visits{marks: make([]visit, 2*len(m.states))}
+	for _, start := range starts {
+		for _, t := range m.follow(nil, &v, thread{state: start}, 0, func(int, int, *Node) {}) {
+			m.firsts = append(m.firsts, t.state)
+		}
+	}
+	return m
+}
+
+func (m *nfa) add(s nfaState) int32 {
+	m.states = append(m.states, s)
+	return int32(len(m.states) - 1)
+}
+
+// build adds the states of t, followed by the state next, and returns its first state.
+// the states are built from the end, so every state knows where it goes on to.
+func (m *nfa) build(t *term, next int32, repeats bool, confusables Confusables) int32 {
+	switch t.kind {
+	case classTerm:
+		class := t.class
+		class.runes = confusables.foldAll(class.runes)
+		if m.separators && !class.negated && !class.digit && !class.hebrew && onlySeparators(class.runes) {
+			// the separators of the text are skipped, so the ones of the pattern are too
+			return next
+		}
+		return m.add(nfaState{class: &class, loop: repeats, out: next, alt: -1})
+	case concatTerm:
+		for i := len(t.terms) - 1; i >= 0; i-- {
+			next = m.build(t.terms[i], next, repeats, confusables)
+		}
+		return next
+	case alternateTerm:
+		first := m.build(t.terms[len(t.terms)-1], next, repeats, confusables)
+		for i := len(t.terms) - 2; i >= 0; i-- {
+			first = m.add(nfaState{out: m.build(t.terms[i], next, repeats, confusables), alt: first})
+		}
+		return first
+	default:
+		// x{2,4} is built as x x (x (x)?)?
+		cur := next
+		for i := t.min; i < t.max; i++ {
+			cur = m.add(nfaState{out: m.build(t.terms[0], cur, repeats, confusables), alt: next})
+		}
+		for i := 0; i < t.min; i++ {
+			cur = m.build(t.terms[0], cur, repeats, confusables)
+		}
+		return cur
+	}
+}
+
+func onlySeparators(runes []rune) bool {
+	for _, r := range runes {
+		if !utils.IsEndOfWordSign(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// search calls found for every text[start:end] an expression matches. plain is
+// the text before the confusables were applied, for the digit and letter classes.
+func (m *nfa) search(text, plain []rune, found func(start, end int, node *Node)) {
+	// positions[k] is where in text the k-th rune that is read came from
+	positions := make([]int, 0, len(text))
+	for i, char := range text {
+		if !m.separators || !utils.IsEndOfWordSign(char) {
+			positions = append(positions, i)
+		}
+	}
+	report := func(start, end int, node *Node) {
+		if node.CollapseRepeats {
+			// a run is read as a whole, a match does not start or end in the middle of one
+			if start > 0 && text[positions[start-1]] == text[positions[start]] {
+				return
+			}
+			if end < len(positions) && text[positions[end]] == text[positions[end-1]] {
+				return
+			}
+		}
+		found(positions[start], positions[end-1]+1, node)
+	}
+	var current, next []thread
+	v := visits{marks: make([]visit, 2*len(m.states))}
+	for k, i := range positions {
+		next = next[:0]
+		v.generation++
+		step := func(t thread) {
+			s := m.states[t.state]
+			if t.repeat != 0 {
+				if text[i] != t.repeat {
+					return
+				}
+			} else if !s.class.matches(text[i], plain[i]) {
+				return
+			}
+			next = m.follow(next, &v, thread{state: s.out, start: t.start}, k+1, report)
+			if s.loop {
+				next = m.follow(next, &v, thread{state: t.state, start: t.start, repeat: text[i]}, k+1, report)
+			}
+		}
+		for _, t := range current {
+			step(t)
+		}
+		// the new threads start last, as the threads of a step are kept in the order of their starts
+		for _, first := range m.firsts {
+			step(thread{state: first, start: k})
+		}
+		current, next = next, current
+	}
+}
+
+// visits remembers the threads added in a step. the threads of a step are added
+// in the order of their starts, so a state only has to remember the last start it
+// was added with. a thread in the middle of a run is kept apart from the one at the state.
+type visits struct {
+	marks      []visit
+	generation int
+}
+
+type visit struct {
+	generation, start int
+}
+
+func (v *visits) add(t thread, states int) bool {
+	key := int(t.state)
+	if t.repeat != 0 {
+		key += states
+	}
+	mark := visit{generation: v.generation + 1, start: t.start}
+	if v.marks[key] == mark {
+		return false
+	}
+	v.marks[key] = mark
+	return true
+}
+
+// follow adds t to threads, after following the states that do not read. a thread
+// that reaches an accepting state is a match that ends at end.
+func (m *nfa) follow(threads []thread, v *visits, t thread, end int, report func(start, end int, node *Node)) []thread {
+	if !v.add(t, len(m.states)) {
+		return threads
+	}
+	s := m.states[t.state]
+	switch {
+	case s.node != nil:
+		if end > t.start {
+			report(t.start, end, s.node)
+		}
+	case s.class != nil:
+		threads = append(threads, t)
+	default:
+		threads = m.follow(threads, v, thread{state: s.out, start: t.start}, end, report)
+		threads = m.follow(threads, v, thread{state: s.alt, start: t.start}, end, report)
+	}
+	return threads
+}
@@ -0,0 +1,82 @@
+package maptree
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/mekavehamichlolay/bad-word-service/utils"
+)
+
+// normalized is a text prepared for scanning. it is NFKC normalized, the hebrew
+// marks and the invisible format characters are removed and the runes are folded.
+// starts and ends map every rune back to the runes of the original text.
+type normalized struct {
+	// runes are matched against the patterns, plain are the same runes before the
+	// confusables were applied, for the word boundary checks.
+	runes, plain []rune
+	// runes[i] came from the original runes starts[i] up to ends[i]. a rune that
+	// NFKC produced from a few others covers all of them, and the removed runes
+	// are counted in the rune before them.
+	starts, ends []int
+	confusables  Confusables
+}
+
+func normalize(text string, confusables Confusables) normalized {
+	n := normalized{
+		confusables: confusables,
+		runes:       make([]rune, 0, len(text)),
+		plain:       make([]rune, 0, len(text)),
+		starts:      make([]int, 0, len(text)),
+		ends:        make([]int, 0, len(text)),
+	}
+	position := 0
+	var iter norm.Iter
+	iter.InitString(norm.NFKC, text)
+	for !iter.Done() {
+		from := iter.Pos()
+		segment := iter.Next()
+		original := text[from:iter.Pos()]
+		if string(segment) == original {
+			// NFKC did not change it, so every rune keeps its own place
+			for _, r := range original {
+				n.add(r, position, position+1)
+				position++
+			}
+			continue
+		}
+		// NFKC composed or decomposed it, every rune it produced covers all of it
+		length := utf8.RuneCountInString(original)
+		for _, r := range string(segment) {
+			n.add(r, position, position+length)
+		}
+		position += length
+	}
+	return n
+}
+
+func (n *normalized) add(r rune, start, end int) {
+	if ignorable(r) {
+		if len(n.ends) > 0 {
+			n.ends[len(n.ends)-1] = end
+		}
+		return
+	}
+	n.runes = append(n.runes, n.confusables.fold(r))
+	n.plain = append(n.plain, utils.Fold(r))
+	n.starts = append(n.starts, start)
+	n.ends = append(n.ends, end)
+}
+
+// span returns the position in the original text of runes[start:end].
+func (n normalized) span(start, end int) [2]uint {
+	return [2]uint{uint(n.starts[start]), uint(n.ends[end-1])}
+}
+
+// ignorable reports whether r is removed before matching, a hebrew vowel point or
+// cantillation mark, or an invisible format character such as a zero width joiner,
+// a direction mark or a soft hyphen.
+func ignorable(r rune) bool {
+	return utils.IsHebrewMark(r) || unicode.Is(unicode.Cf, r)
+}
@@ -0,0 +1,477 @@
+package maptree
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/mekavehamichlolay/bad-word-service/utils"
+)
+
+/*
+The pattern language of mw_bad_words:
+
+	^          at the very start, the match must start a word
+	$          at the very end, the match must end a word
+	[abc]      one of the characters, at least two of them unless the class is optional
+	[^abc]     any character but these
+	\d         a digit
+	\h         a hebrew letter
+	(a|bc)     one of the alternatives, a | outside of parentheses splits the whole pattern
+	x?         x is optional
+	x{n}       x exactly n times
+	x{n,m}     x between n and m times, m is at most maxRepeat
+	\x         the character x itself, for the special characters ^ $ [ ] ( ) | ? { } and \
+
+every other character stands for itself. the hebrew marks are ignored.
+*/
+
+// maxRepeat is the biggest upper bound of a {n,m} repetition.
+const maxRepeat = 16
+
+// PatternError tells where a pattern could not be parsed.
+type PatternError struct {
+	// Column is the position of the failing character in the pattern, counted in characters from one.
+	Column int    `json:"column"`
+	Reason string `json:"reason"`
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Reason)
+}
+
+type termKind int
+
+const (
+	classTerm termKind = iota
+	concatTerm
+	alternateTerm
+	repeatTerm
+)
+
+// term is a node of the syntax tree of a pattern.
+type term struct {
+	kind termKind
+	// class is the character class of a classTerm, a literal is a class of one character
+	class charClass
+	// terms are the parts of a concatTerm, the alternatives of an alternateTerm
+	// or the repeated term of a repeatTerm
+	terms    []*term
+	min, max int
+}
+
+// charClass is a set of characters. runes are compared with the folded text,
+// the predefined classes with the text before the confusables are applied,
+// so a 0 is still a digit.
+type charClass struct {
+	runes         []rune
+	negated       bool
+	digit, hebrew bool
+}
+
+func (c charClass) matches(folded, plain rune) bool {
+	in := slices.Contains(c.runes, folded) ||
+		(c.digit && plain >= '0' && plain <= '9') ||
+		(c.hebrew && utils.IsHebrewLetter(plain))
+	return in != c.negated
+}
+
+// pattern is a parsed mw_bad_words entry.
+type pattern struct {
+	startOfWordOnly, endOfWordOnly bool
+	// text is the normalized pattern without the anchors
+	text []rune
+	root *term
+}
+
+type parser struct {
+	runes []rune
+	// columns[i] is the column of runes[i] in the pattern as it was written
+	columns []int
+	pos     int
+}
+
+// parsePattern parses a pattern. the hebrew marks are dropped and every character
+// is NFKC normalized, the errors point at the column in the pattern as it was written.
+func parsePattern(source string) (*pattern, error) {
+	p := &parser{}
+	for column, r := range []rune(source) {
+		if ignorable(r) {
+			continue
+		}
+		for _, n := range norm.NFKC.String(string(r)) {
+			if !ignorable(n) {
+				p.runes = append(p.runes, n)
+				p.columns = append(p.columns, column+1)
+			}
+		}
+	}
+	result := &pattern{}
+	if p.peek() == '^' {
+		result.startOfWordOnly = true
+		p.pos++
+	}
+	if last := len(p.runes) - 1; last >= p.pos && p.runes[last] == '$' && !p.escaped(last) {
+		result.endOfWordOnly = true
+		p.runes = p.runes[:last]
+	}
+	if len(p.runes)-p.pos < 2 {
+		return nil, p.errorAt(len(p.runes), "word length must be at least two characters")
+	}
+	result.text = p.runes[p.pos:]
+	root, err := p.alternation()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.runes) {
+		// only an unopened ) stops the top level alternation
+		return nil, p.errorf("a ) without an opening (")
+	}
+	if root.minLength() < 2 {
+		// like a word, a pattern must be at least two characters long whatever it matches
+		return nil, p.errorAt(len(p.runes), "the pattern can match less than two characters")
+	}
+	result.root = root
+	return result, nil
+}
+
+// escaped reports whether the rune at i follows an odd number of backslashes.
+func (p *parser) escaped(i int) bool {
+	odd := false
+	for i--; i >= 0 && p.runes[i] == '\\'; i-- {
+		odd = !odd
+	}
+	return odd
+}
+
+func (p *parser) peek() rune {
+	if p.pos >= len(p.runes) {
+		return 0
+	}
+	return p.runes[p.pos]
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return p.errorAt(p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) errorAt(pos int, reason string) error {
+	column := 1
+	if len(p.columns) > 0 {
+		if pos < len(p.columns) {
+			column = p.columns[pos]
+		} else {
+			column = p.columns[len(p.columns)-1] + 1
+		}
+	}
+	return &PatternError{Column: column, Reason: reason}
+}
+
+func (p *parser) alternation() (*term, error) {
+	first, err := p.sequence()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != '|' {
+		return first, nil
+	}
+	alternatives := []*term{first}
+	for p.peek() == '|' {
+		p.pos++
+		next, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, next)
+	}
+	return &term{kind: alternateTerm, terms: alternatives}, nil
+}
+
+func (p *parser) sequence() (*term, error) {
+	var terms []*term
+	for p.pos < len(p.runes) && p.peek() != '|' && p.peek() != ')' {
+		atom, err := p.atom()
+		if err != nil {
+			return nil, err
+		}
+		if atom, err = p.quantifier(atom); err != nil {
+			return nil, err
+		}
+		terms = append(terms, atom)
+	}
+	if len(terms) == 0 {
+		return nil, p.errorf("an empty alternative")
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return &term{kind: concatTerm, terms: terms}, nil
+}
+
+func (p *parser) atom() (*term, error) {
+	start := p.pos
+	switch char := p.peek(); char {
+	case '(':
+		p.pos++
+		inner, err := p.alternation()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorAt(start, "a ( without a closing )")
+		}
+		p.pos++
+		return inner, nil
+	case '[':
+		return p.class()
+	case '\\':
+		class, err := p.escape()
+		if err != nil {
+			return nil, err
+		}
+		return &term{kind: classTerm, class: class}, nil
+	case '^':
+		return nil, p.errorf("^ can only start the pattern, use \\^ for the character")
+	case '$':
+		return nil, p.errorf("$ can only end the pattern, use \\$ for the character")
+	case '?', '{', '}', ']':
+		return nil, p.errorf("%c has nothing to apply to, use \\%c for the character", char, char)
+	default:
+		p.pos++
+		return &term{kind: classTerm, class: charClass{runes: []rune{char}}}, nil
+	}
+}
+
+// escape parses a \ and the character after it.
+func (p *parser) escape() (charClass, error) {
+	p.pos++
+	if p.pos >= len(p.runes) {
+		return charClass{}, p.errorAt(p.pos-1, "a \\ at the end of the pattern")
+	}
+	char := p.peek()
+	p.pos++
+	switch char {
+	case 'd':
+		return charClass{digit: true}, nil
+	case 'h':
+		return charClass{hebrew: true}, nil
+	}
+	if utils.IsEnglishLetter(char) || utils.IsHebrewLetter(char) {
+		return charClass{}, p.errorAt(p.pos-1, fmt.Sprintf("unknown class \\%c", char))
+	}
+	return charClass{runes: []rune{char}}, nil
+}
+
+func (p *parser) class() (*term, error) {
+	start := p.pos
+	p.pos++
+	var class charClass
+	if p.peek() == '^' {
+		class.negated = true
+		p.pos++
+	}
+	members := 0
+	for p.peek() != ']' {
+		if p.pos >= len(p.runes) {
+			return nil, p.errorAt(start, "you have an open bracket without a closing bracket")
+		}
+		if p.peek() == '\\' {
+			escaped, err := p.escape()
+			if err != nil {
+				return nil, err
+			}
+			class.runes = append(class.runes, escaped.runes...)
+			class.digit = class.digit || escaped.digit
+			class.hebrew = class.hebrew || escaped.hebrew
+		} else {
+			class.runes = append(class.runes, p.peek())
+			p.pos++
+		}
+		members++
+	}
+	p.pos++
+	if members == 0 {
+		return nil, p.errorAt(start, "an empty class")
+	}
+	if members < 2 && !class.negated && p.peek() != '?' {
+		return nil, p.errorAt(start, "you have less than 2 optional characters")
+	}
+	return &term{kind: classTerm, class: class}, nil
+}
+
+func (p *parser) quantifier(atom *term) (*term, error) {
+	switch p.peek() {
+	case '?':
+		p.pos++
+		return &term{kind: repeatTerm, terms: []*term{atom}, min: 0, max: 1}, nil
+	case '{':
+		start := p.pos
+		p.pos++
+		low, ok := p.number()
+		if !ok {
+			return nil, p.errorf("expected a number in the repetition")
+		}
+		high := low
+		if p.peek() == ',' {
+			p.pos++
+			if high, ok = p.number(); !ok {
+				return nil, p.errorf("expected the upper bound of the repetition")
+			}
+		}
+		if p.peek() != '}' {
+			return nil, p.errorAt(start, "a { without a closing }")
+		}
+		p.pos++
+		if high < low || high == 0 {
+			return nil, p.errorAt(start, fmt.Sprintf("the repetition {%d,%d} is empty", low, high))
+		}
+		if high > maxRepeat {
+			return nil, p.errorAt(start, fmt.Sprintf("a repetition can be at most %d", maxRepeat))
+		}
+		return &term{kind: repeatTerm, terms: []*term{atom}, min: low, max: high}, nil
+	}
+	return atom, nil
+}
+
+func (p *parser) number() (int, bool) {
+	start := p.pos
+	for p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(string(p.runes[start:p.pos]))
+	return n, err == nil
+}
+
+// minLength returns the length of the shortest text the term matches.
+func (t *term) minLength() int {
+	switch t.kind {
+	case concatTerm:
+		length := 0
+		for _, sub := range t.terms {
+			length += sub.minLength()
+		}
+		return length
+	case alternateTerm:
+		length := -1
+		for _, sub := range t.terms {
+			if l := sub.minLength(); length == -1 || l < length {
+				length = l
+			}
+		}
+		return length
+	case repeatTerm:
+		return t.min * t.terms[0].minLength()
+	}
+	return 1
+}
+
+// literal returns the text of a term that matches a single text, and false for the rest.
+func (t *term) literal() ([]rune, bool) {
+	switch t.kind {
+	case classTerm:
+		if len(t.class.runes) == 1 && !t.class.negated && !t.class.digit && !t.class.hebrew {
+			return t.class.runes, true
+		}
+	case concatTerm:
+		var text []rune
+		for _, sub := range t.terms {
+			part, ok := sub.literal()
+			if !ok {
+				return nil, false
+			}
+			text = append(text, part...)
+		}
+		return text, true
+	}
+	return nil, false
+}
+
+// expand returns every text the term matches, or an error if there are more than limit
+// of them or the term has a class that can not be listed.
+func (t *term) expand(limit int) ([][]rune, error) {
+	switch t.kind {
+	case classTerm:
+		if t.class.negated {
+			return nil, fmt.Errorf("a negated class can not be expanded")
+		}
+		var texts [][]rune
+		for _, r := range t.class.runes {
+			texts = append(texts, []rune{r})
+		}
+		if t.class.digit {
+			for r := '0'; r <= '9'; r++ {
+				texts = append(texts, []rune{r})
+			}
+		}
+		if t.class.hebrew {
+			for r := utils.ALEPH; r <= utils.TAV; r++ {
+				if utils.ToBaseLetter(r) == r {
+					texts = append(texts, []rune{r})
+				}
+			}
+		}
+		return texts, checkLimit(len(texts), limit)
+	case concatTerm:
+		texts := [][]rune{nil}
+		for _, sub := range t.terms {
+			parts, err := sub.expand(limit)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkLimit(len(texts)*len(parts), limit); err != nil {
+				return nil, err
+			}
+			texts = product(texts, parts)
+		}
+		return texts, nil
+	case alternateTerm:
+		var texts [][]rune
+		for _, sub := range t.terms {
+			parts, err := sub.expand(limit)
+			if err != nil {
+				return nil, err
+			}
+			texts = append(texts, parts...)
+			if err := checkLimit(len(texts), limit); err != nil {
+				return nil, err
+			}
+		}
+		return texts, nil
+	default:
+		parts, err := t.terms[0].expand(limit)
+		if err != nil {
+			return nil, err
+		}
+		var texts [][]rune
+		repeated := [][]rune{nil}
+		for n := 1; n <= t.max; n++ {
+			if n-1 >= t.min {
+				texts = append(texts, repeated...)
+			}
+			if err := checkLimit(len(texts)+len(repeated)*len(parts), limit); err != nil {
+				return nil, err
+			}
+			repeated = product(repeated, parts)
+		}
+		return append(texts, repeated...), checkLimit(len(texts)+len(repeated), limit)
+	}
+}
+
+func checkLimit(n, limit int) error {
+	if n > limit {
+		return fmt.Errorf("the pattern expands to more than %d words", limit)
+	}
+	return nil
+}
+
+func product(prefixes, suffixes [][]rune) [][]rune {
+	texts := make([][]rune, 0, len(prefixes)*len(suffixes))
+	for _, prefix := range prefixes {
+		for _, suffix := range suffixes {
+			texts = append(texts, append(slices.Clip(prefix), suffix...))
+		}
+	}
+	return texts
+}
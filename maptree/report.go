@@ -0,0 +1,10 @@
+package maptree
+
+import "github.com/mekavehamichlolay/bad-word-service/matcher"
+
+// Report returns the report of the last reload.
+func (t *Tree) Report() matcher.LoadReport {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.report
+}
@@ -0,0 +1,66 @@
+package matcher
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Entry is a single compiled word of a Matcher, as it is sent on the "all" socket.
+type Entry struct {
+	ID              int64  `json:"id"`
+	Word            string `json:"word"`
+	Pattern         string `json:"pattern"`
+	DontStartWith   string `json:"dontStartWith"`
+	DontEndWith     string `json:"dontEndWith"`
+	StartOfWordOnly bool   `json:"startOfWordOnly"`
+	EndOfWordOnly   bool   `json:"endOfWordOnly"`
+	AllowPrefixes   bool   `json:"allowPrefixes"`
+	AllowSeparators bool   `json:"allowSeparators"`
+	CollapseRepeats bool   `json:"collapseRepeats"`
+	MaxDistance     int    `json:"maxDistance"`
+	Severity        int    `json:"severity"`
+	Category        string `json:"category"`
+	Replacement     string `json:"replacement"`
+}
+
+// Filter limits the entries returned by Entries. the zero value matches everything.
+type Filter struct {
+	Prefix    string `json:"prefix"`
+	MinLength int    `json:"minLength"`
+	MaxLength int    `json:"maxLength"`
+}
+
+// Match reports whether word passes the filter.
+func (f Filter) Match(word string) bool {
+	if !strings.HasPrefix(word, f.Prefix) {
+		return false
+	}
+	length := utf8.RuneCountInString(word)
+	if f.MinLength > 0 && length < f.MinLength {
+		return false
+	}
+	if f.MaxLength > 0 && length > f.MaxLength {
+		return false
+	}
+	return true
+}
+
+// Entry returns the entry of the word, listed as text.
+func (w *Word) Entry(text string) Entry {
+	return Entry{
+		ID:              w.ID,
+		Word:            text,
+		Pattern:         w.Pattern,
+		DontStartWith:   string(w.DontStartWith),
+		DontEndWith:     string(w.DontEndWith),
+		StartOfWordOnly: w.StartOfWordOnly,
+		EndOfWordOnly:   w.EndOfWordOnly,
+		AllowPrefixes:   w.AllowPrefixes,
+		AllowSeparators: w.AllowSeparators,
+		CollapseRepeats: w.CollapseRepeats,
+		MaxDistance:     w.MaxDistance,
+		Severity:        w.Severity,
+		Category:        w.Category,
+		Replacement:     w.Replacement,
+	}
+}
@@ -0,0 +1,67 @@
+package matcher
+
+import (
+	"slices"
+	"strings"
+)
+
+// MaskMode is how Mask hides a match.
+type MaskMode string
+
+const (
+	// MaskAsterisks replaces every character of the match with a *.
+	MaskAsterisks MaskMode = "asterisks"
+	// MaskFirstLetter keeps the first character and replaces the rest with a *.
+	MaskFirstLetter MaskMode = "first"
+	// MaskReplacement replaces the match with the Replacement of its word,
+	// or with asterisks if the word has none.
+	MaskReplacement MaskMode = "replacement"
+)
+
+// Valid reports whether the mode is one of the known modes.
+func (mode MaskMode) Valid() bool {
+	return mode == MaskAsterisks || mode == MaskFirstLetter || mode == MaskReplacement
+}
+
+// Mask returns text with the matches hidden. the matches that overlap are
+// hidden together as one, and a replacement is only used for them if one of the
+// matches spans all of them, otherwise they get asterisks.
+func Mask(text string, matches []Match, mode MaskMode) string {
+	runes := []rune(text)
+	matches = slices.Clone(matches)
+	slices.SortFunc(matches, func(a, b Match) int {
+		if a.Start != b.Start {
+			return int(a.Start) - int(b.Start)
+		}
+		return int(b.End) - int(a.End)
+	})
+	var masked strings.Builder
+	position := uint(0)
+	for i := 0; i < len(matches); {
+		start, end := matches[i].Start, matches[i].End
+		j := i + 1
+		for ; j < len(matches) && matches[j].Start < end; j++ {
+			end = max(end, matches[j].End)
+		}
+		// sorted by start and then the longest first, only the first match can span the group
+		var word *Word
+		if matches[i].End == end {
+			word = matches[i].Word
+		}
+		masked.WriteString(string(runes[position:start]))
+		masked.WriteString(mask(runes[start:end], word, mode))
+		position, i = end, j
+	}
+	masked.WriteString(string(runes[position:]))
+	return masked.String()
+}
+
+func mask(span []rune, word *Word, mode MaskMode) string {
+	switch {
+	case mode == MaskReplacement && word != nil && word.Replacement != "":
+		return word.Replacement
+	case mode == MaskFirstLetter:
+		return string(span[0]) + strings.Repeat("*", len(span)-1)
+	}
+	return strings.Repeat("*", len(span))
+}
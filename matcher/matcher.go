@@ -0,0 +1,93 @@
+/*
+Package matcher holds what the engines of the service share: the Matcher interface
+the service checks texts with, the words and matches they return, the load report,
+and the masking, overlap and offset handling of the responses. maptree and tree
+both implement Matcher.
+*/
+package matcher
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/mekavehamichlolay/bad-word-service/utils"
+)
+
+// Matcher is a word list the service checks the texts against.
+type Matcher interface {
+	HasWord(text string) [][2]uint
+	// Matches returns the words found in text, sorted by their start and end,
+	// with rune positions in text.
+	Matches(text string) []Match
+	Has(word string) bool
+	Len() int
+	// Reset replaces the words with the rows of query, which selects the columns
+	// of mw_bad_words in the order database.BadWordsQuery lists them.
+	Reset(ctx context.Context, conn *sql.Conn, query string) error
+	Report() LoadReport
+	Entries(filter Filter, fn func(Entry) error) error
+}
+
+// Word is a loaded entry of mw_bad_words, what a match tells about the word it found.
+type Word struct {
+	// ID is the row of the word in mw_bad_words, zero for the words added by AddWord and Set.
+	ID int64
+	// Pattern is the entry as it was written in the database.
+	Pattern                        string
+	DontStartWith, DontEndWith     []rune
+	EndOfWordOnly, StartOfWordOnly bool
+	AllowPrefixes, AllowSeparators bool
+	CollapseRepeats                bool
+	MaxDistance                    int
+	Severity                       int
+	Category                       string
+	Replacement                    string
+}
+
+// Match is a word found in a text. Start and End are rune positions in the original text.
+type Match struct {
+	Start, End uint
+	// Distance is the number of edits between the text and the word, zero unless
+	// the word allows a distance
+	Distance int
+	Word     *Word
+}
+
+// Allowed checks the boundary constraints of the word against the runes
+// around text[start:end]. it gets the runes before the confusables are applied,
+// so a ! after a word still ends it.
+func (w *Word) Allowed(text []rune, start, end int) bool {
+	if w.StartOfWordOnly && start != 0 && !isStartOrEndOfWord(text[start-1]) &&
+		!(w.AllowPrefixes && OnlyPrefixesBefore(text, start)) {
+		return false
+	}
+	if w.EndOfWordOnly && end != len(text) && !isStartOrEndOfWord(text[end]) {
+		return false
+	}
+	if start != 0 && slices.Contains(w.DontStartWith, text[start-1]) {
+		return false
+	}
+	if end != len(text) && slices.Contains(w.DontEndWith, text[end]) {
+		return false
+	}
+	return true
+}
+
+// OnlyPrefixesBefore reports whether the runes between the start of the word and
+// text[start] are all hebrew prefix letters.
+func OnlyPrefixesBefore(text []rune, start int) bool {
+	i := start - 1
+	for i >= 0 && utils.IsHebrewPrefixLetter(text[i]) {
+		i--
+	}
+	return i < 0 || isStartOrEndOfWord(text[i])
+}
+
+func isStartOrEndOfWord(c rune) bool {
+	switch c {
+	case ' ', '\n', '\t', '\r', '|', '!', '?', '.', ',', ';', ':', '(', ')', '[', ']', '{', '}', '<', '>', '/', '\\', '%', '@', '&', '*', '^', '+', '-', '_', '=', '~', '`':
+		return true
+	}
+	return false
+}
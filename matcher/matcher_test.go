@@ -0,0 +1,106 @@
+package matcher
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	bad := &Word{Replacement: "good"}
+	word := &Word{}
+	tests := []struct {
+		text    string
+		matches []Match
+		mode    MaskMode
+		want    string
+	}{
+		{"a bad word", nil, MaskAsterisks, "a bad word"},
+		{"a bad word", []Match{{Start: 2, End: 5, Word: bad}}, MaskAsterisks, "a *** word"},
+		{"a bad word", []Match{{Start: 2, End: 5, Word: bad}}, MaskFirstLetter, "a b** word"},
+		{"a bad word", []Match{{Start: 2, End: 5, Word: bad}, {Start: 6, End: 10, Word: word}}, MaskReplacement, "a good ****"},
+		// overlapping matches are masked as one
+		{"a badword", []Match{{Start: 2, End: 5, Word: bad}, {Start: 4, End: 9, Word: word}}, MaskFirstLetter, "a b******"},
+		{"a badword", []Match{{Start: 4, End: 9, Word: word}, {Start: 2, End: 5, Word: bad}}, MaskReplacement, "a *******"},
+		{"a badword", []Match{{Start: 2, End: 9, Word: bad}, {Start: 2, End: 5, Word: word}}, MaskReplacement, "a good"},
+		{"זו מילה רעה", []Match{{Start: 3, End: 7, Word: word}}, MaskFirstLetter, "זו מ*** רעה"},
+	}
+	for _, test := range tests {
+		if got := Mask(test.text, test.matches, test.mode); got != test.want {
+			t.Errorf("Mask(%q, %v) = %q, want %q", test.text, test.mode, got, test.want)
+		}
+	}
+}
+
+func TestResolveOverlaps(t *testing.T) {
+	short, long := &Word{Pattern: "short"}, &Word{Pattern: "long"}
+	type span struct {
+		start, end uint
+		pattern    string
+	}
+	tests := []struct {
+		name    string
+		matches []span
+		policy  OverlapPolicy
+		want    []span
+	}{
+		{"empty", nil, OverlapLongest, nil},
+		{"all keeps everything", []span{{2, 5, "short"}, {2, 9, "long"}}, OverlapAll, []span{{2, 5, "short"}, {2, 9, "long"}}},
+		{"no policy keeps everything", []span{{2, 5, "short"}, {2, 9, "long"}}, "", []span{{2, 5, "short"}, {2, 9, "long"}}},
+		{"longest of the same start", []span{{2, 5, "short"}, {2, 9, "long"}}, OverlapLongest, []span{{2, 9, "long"}}},
+		{"leftmost before longest", []span{{0, 3, "short"}, {2, 9, "long"}}, OverlapLongest, []span{{0, 3, "short"}}},
+		{"nested", []span{{0, 9, "long"}, {3, 5, "short"}}, OverlapLongest, []span{{0, 9, "long"}}},
+		{"touching do not overlap", []span{{0, 3, "short"}, {3, 9, "long"}}, OverlapLongest, []span{{0, 3, "short"}, {3, 9, "long"}}},
+		{"after a skipped match", []span{{0, 4, "short"}, {2, 6, "long"}, {5, 8, "short"}}, OverlapLongest, []span{{0, 4, "short"}, {5, 8, "short"}}},
+		{"merged spans both", []span{{0, 3, "short"}, {2, 9, "long"}}, OverlapMerged, []span{{0, 9, "long"}}},
+		{"merged chain", []span{{0, 4, "short"}, {2, 6, "short"}, {5, 8, "short"}, {9, 12, "long"}}, OverlapMerged, []span{{0, 8, "short"}, {9, 12, "long"}}},
+		{"merged nested", []span{{3, 5, "short"}, {0, 9, "long"}}, OverlapMerged, []span{{0, 9, "long"}}},
+		{"merged touching", []span{{0, 3, "short"}, {3, 9, "long"}}, OverlapMerged, []span{{0, 3, "short"}, {3, 9, "long"}}},
+	}
+	for _, test := range tests {
+		var matches []Match
+		for _, s := range test.matches {
+			node := short
+			if s.pattern == "long" {
+				node = long
+			}
+			matches = append(matches, Match{Start: s.start, End: s.end, Word: node})
+		}
+		var got []span
+		for _, m := range ResolveOverlaps(matches, test.policy) {
+			got = append(got, span{m.Start, m.End, m.Word.Pattern})
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: ResolveOverlaps() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	tests := []struct {
+		text string
+		unit OffsetUnit
+		want []uint
+	}{
+		{"abc", OffsetRunes, []uint{0, 1, 2, 3}},
+		{"abc", "", []uint{0, 1, 2, 3}},
+		{"abc", OffsetBytes, []uint{0, 1, 2, 3}},
+		{"abc", OffsetUTF16, []uint{0, 1, 2, 3}},
+		{"aמb", OffsetBytes, []uint{0, 1, 3, 4}},
+		{"aמb", OffsetUTF16, []uint{0, 1, 2, 3}},
+		{"a😀b", OffsetBytes, []uint{0, 1, 5, 6}},
+		{"a😀b", OffsetUTF16, []uint{0, 1, 3, 4}},
+		{"a\xffb", OffsetBytes, []uint{0, 1, 2, 3}},
+		{"a\xffb", OffsetUTF16, []uint{0, 1, 2, 3}},
+		{"", OffsetUTF16, []uint{0}},
+	}
+	for _, test := range tests {
+		offsets := NewOffsets(test.text, test.unit)
+		var got []uint
+		for position := range test.want {
+			got = append(got, offsets.Convert(uint(position)))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("NewOffsets(%q, %q) = %v, want %v", test.text, test.unit, got, test.want)
+		}
+	}
+}
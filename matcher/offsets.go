@@ -0,0 +1,61 @@
+package matcher
+
+import "unicode/utf8"
+
+// OffsetUnit is what the positions of a response count.
+type OffsetUnit string
+
+const (
+	// OffsetRunes counts code points, the unit of Match and of PHP's mb_substr.
+	OffsetRunes OffsetUnit = "runes"
+	// OffsetBytes counts the bytes of the UTF-8 text.
+	OffsetBytes OffsetUnit = "bytes"
+	// OffsetUTF16 counts UTF-16 code units, the unit of JavaScript strings.
+	OffsetUTF16 OffsetUnit = "utf16"
+)
+
+// Valid reports whether the unit is one of the known units.
+func (unit OffsetUnit) Valid() bool {
+	return unit == OffsetRunes || unit == OffsetBytes || unit == OffsetUTF16
+}
+
+// Offsets converts the rune positions of a text to another unit.
+type Offsets struct {
+	// positions[i] is rune position i in the unit, nil when the unit is runes
+	positions []uint
+}
+
+// NewOffsets prepares the conversion of the positions of text, the empty unit is runes.
+// an invalid UTF-8 byte is a rune of its own, as it is when the text is scanned.
+func NewOffsets(text string, unit OffsetUnit) Offsets {
+	if unit == "" || unit == OffsetRunes {
+		return Offsets{}
+	}
+	positions := make([]uint, 0, len(text)+1)
+	position := uint(0)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		positions = append(positions, position)
+		switch unit {
+		case OffsetBytes:
+			position += uint(size)
+		case OffsetUTF16:
+			// the runes past the basic plane are a surrogate pair, an invalid
+			// byte is read as U+FFFD, a single unit
+			position++
+			if r > 0xFFFF {
+				position++
+			}
+		}
+		i += size
+	}
+	return Offsets{positions: append(positions, position)}
+}
+
+// Convert returns the rune position in the unit of the Offsets.
+func (o Offsets) Convert(position uint) uint {
+	if o.positions == nil {
+		return position
+	}
+	return o.positions[position]
+}
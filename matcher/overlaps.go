@@ -0,0 +1,53 @@
+package matcher
+
+import "slices"
+
+// OverlapPolicy is what ResolveOverlaps does with the matches that overlap.
+type OverlapPolicy string
+
+const (
+	// OverlapAll keeps every match, nested and overlapping ones too.
+	OverlapAll OverlapPolicy = "all"
+	// OverlapLongest keeps, from the left, the longest match that does not
+	// overlap one kept before it.
+	OverlapLongest OverlapPolicy = "longest"
+	// OverlapMerged joins the matches that overlap into one match that spans them,
+	// with the word and distance of the longest of them.
+	OverlapMerged OverlapPolicy = "merged"
+)
+
+// Valid reports whether the policy is one of the known policies.
+func (policy OverlapPolicy) Valid() bool {
+	return policy == OverlapAll || policy == OverlapLongest || policy == OverlapMerged
+}
+
+// ResolveOverlaps applies the policy to the matches, the empty policy keeps them all.
+// the result is sorted by start and end, like the matches of Matches.
+func ResolveOverlaps(matches []Match, policy OverlapPolicy) []Match {
+	if policy == "" || policy == OverlapAll || len(matches) == 0 {
+		return matches
+	}
+	matches = slices.Clone(matches)
+	// from the left, and on the same start the longest first
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		if a.Start != b.Start {
+			return int(a.Start) - int(b.Start)
+		}
+		return int(b.End) - int(a.End)
+	})
+	result := matches[:1]
+	for _, match := range matches[1:] {
+		last := &result[len(result)-1]
+		if match.Start >= last.End {
+			result = append(result, match)
+			continue
+		}
+		if policy == OverlapMerged {
+			if match.End-match.Start > last.End-last.Start {
+				last.Word, last.Distance = match.Word, match.Distance
+			}
+			last.End = max(last.End, match.End)
+		}
+	}
+	return result
+}
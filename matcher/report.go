@@ -0,0 +1,23 @@
+package matcher
+
+import "time"
+
+// RowError is a row of mw_bad_words a reload skipped, or loaded without some of its options.
+type RowError struct {
+	ID      int64  `json:"id"`
+	Pattern string `json:"pattern"`
+	Error   string `json:"error"`
+}
+
+// LoadReport tells how the last reload went, as it is sent on the "status" socket.
+type LoadReport struct {
+	Time time.Time `json:"time"`
+	// Words is the number of words in the active list
+	Words   int        `json:"words"`
+	Skipped []RowError `json:"skipped"`
+	// Ignored are the rows loaded without the options the engine does not support,
+	// they match more or fewer texts than the row asks for
+	Ignored []RowError `json:"ignored,omitempty"`
+	// Error is why the reload failed as a whole, the list loaded before it stays active
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+	"github.com/mekavehamichlolay/bad-word-service/server"
+)
+
+// matchResponse is a match in the version 2 response.
+type matchResponse struct {
+	Start uint `json:"start"`
+	End   uint `json:"end"`
+	// Text is the matched part of the request text, as it was sent
+	Text     string `json:"text"`
+	Distance int    `json:"distance"`
+	Severity int    `json:"severity"`
+	Category string `json:"category"`
+	// Pattern and ID are the mw_bad_words entry that matched
+	Pattern string     `json:"pattern"`
+	ID      int64      `json:"id"`
+	Flags   matchFlags `json:"flags"`
+}
+
+// matchFlags are the options of the entry that applied to the match.
+type matchFlags struct {
+	StartOfWordOnly bool `json:"startOfWordOnly"`
+	EndOfWordOnly   bool `json:"endOfWordOnly"`
+	AllowPrefixes   bool `json:"allowPrefixes"`
+	AllowSeparators bool `json:"allowSeparators"`
+	CollapseRepeats bool `json:"collapseRepeats"`
+	MaxDistance     int  `json:"maxDistance"`
+}
+
+// maskedResponse is the response to a request that asked for a mask. the matches
+// are in the format of the version, with their positions in the original text.
+type maskedResponse struct {
+	Text    string `json:"text"`
+	Matches any    `json:"matches"`
+}
+
+// check finds the words in the text of the request and marshals them in the
+// response version the request asked for.
+// the matches of the words the request filtered out are dropped in both versions,
+// before the overlaps are resolved.
+func check(words matcher.Matcher, request server.Request) ([]byte, error) {
+	matches := slices.DeleteFunc(words.Matches(request.Text), func(match matcher.Match) bool {
+		return !request.Wants(match.Word.Severity, match.Word.Category)
+	})
+	matches = matcher.ResolveOverlaps(matches, request.Overlaps)
+	response := format(request, matches)
+	if request.Mask != "" {
+		return json.Marshal(maskedResponse{Text: matcher.Mask(request.Text, matches, request.Mask), Matches: response})
+	}
+	return json.Marshal(response)
+}
+
+// format returns the matches in the response version of the request, with
+// their positions in the unit the request asked for.
+func format(request server.Request, matches []matcher.Match) any {
+	offsets := matcher.NewOffsets(request.Text, request.Offsets)
+	if request.Version == 1 {
+		// no match is null and two words on the same text are one pair, as HasWord returns them
+		var positions [][2]uint
+		for _, match := range matches {
+			position := [2]uint{offsets.Convert(match.Start), offsets.Convert(match.End)}
+			if len(positions) == 0 || positions[len(positions)-1] != position {
+				positions = append(positions, position)
+			}
+		}
+		return positions
+	}
+	// the matches count runes, so the text is sliced as runes
+	text := []rune(request.Text)
+	response := make([]matchResponse, len(matches))
+	for i, match := range matches {
+		word := match.Word
+		response[i] = matchResponse{
+			Start:    offsets.Convert(match.Start),
+			End:      offsets.Convert(match.End),
+			Text:     string(text[match.Start:match.End]),
+			Distance: match.Distance,
+			Severity: word.Severity,
+			Category: word.Category,
+			Pattern:  word.Pattern,
+			ID:       word.ID,
+			Flags: matchFlags{
+				StartOfWordOnly: word.StartOfWordOnly,
+				EndOfWordOnly:   word.EndOfWordOnly,
+				AllowPrefixes:   word.AllowPrefixes,
+				AllowSeparators: word.AllowSeparators,
+				CollapseRepeats: word.CollapseRepeats,
+				MaxDistance:     word.MaxDistance,
+			},
+		}
+	}
+	return response
+}
+
+// errorResponse marshals an error for the client.
+func errorResponse(err error) []byte {
+	jsoned, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+	return jsoned
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mekavehamichlolay/bad-word-service/maptree"
+	"github.com/mekavehamichlolay/bad-word-service/server"
+)
+
+func TestCheck(t *testing.T) {
+	words := maptree.NewTree()
+	for word, options := range map[string]maptree.Options{
+		"bad":     {Severity: 1, Category: "profanity", Replacement: "good"},
+		"badword": {Severity: 3, Category: "hate"},
+		"^מילה":   {Severity: 2, Category: "hate", AllowPrefixes: true},
+	} {
+		if err := words.AddWord([]rune(word), nil, nil, options); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const text = "😀 a badword, המילה"
+	tests := []struct {
+		name   string
+		header string
+		text   string
+		want   string
+	}{
+		{"version 1", "", text, `[[4,7],[4,11],[14,18]]`},
+		{"version 1 without matches", "", "nothing", `null`},
+		{"version 1 bytes", `{"offsets":"bytes"}`, text, `[[7,10],[7,14],[18,26]]`},
+		{"version 1 utf16", `{"offsets":"utf16"}`, text, `[[5,8],[5,12],[15,19]]`},
+		{"version 2 filtered", `{"version":2,"minSeverity":2,"categories":["hate"],"overlaps":"longest"}`, text,
+			`[{"start":4,"end":11,"text":"badword","distance":0,"severity":3,"category":"hate","pattern":"badword","id":0,` +
+				`"flags":{"startOfWordOnly":false,"endOfWordOnly":false,"allowPrefixes":false,"allowSeparators":false,"collapseRepeats":false,"maxDistance":0}},` +
+				`{"start":14,"end":18,"text":"מילה","distance":0,"severity":2,"category":"hate","pattern":"^מילה","id":0,` +
+				`"flags":{"startOfWordOnly":true,"endOfWordOnly":false,"allowPrefixes":true,"allowSeparators":false,"collapseRepeats":false,"maxDistance":0}}]`},
+		{"version 2 without matches", `{"version":2}`, "nothing", `[]`},
+		{"version 2 bytes text", `{"version":2,"offsets":"bytes","categories":["profanity"]}`, text,
+			`[{"start":7,"end":10,"text":"bad","distance":0,"severity":1,"category":"profanity","pattern":"bad","id":0,` +
+				`"flags":{"startOfWordOnly":false,"endOfWordOnly":false,"allowPrefixes":false,"allowSeparators":false,"collapseRepeats":false,"maxDistance":0}}]`},
+		{"mask", `{"mask":"asterisks","overlaps":"merged"}`, text, `{"text":"😀 a *******, ה****","matches":[[4,11],[14,18]]}`},
+		{"mask replacement", `{"mask":"replacement","categories":["profanity"],"offsets":"utf16"}`, text,
+			`{"text":"😀 a goodword, המילה","matches":[[5,8]]}`},
+		{"mask first", `{"mask":"first","minSeverity":3}`, "badword", `{"text":"b******","matches":[[0,7]]}`},
+	}
+	for _, test := range tests {
+		payload := test.text
+		if test.header != "" {
+			payload = string(server.HeaderMark) + test.header + "\n" + test.text
+		}
+		request, err := server.ParseRequest([]byte(payload))
+		if err != nil {
+			t.Fatalf("%s: ParseRequest() = %v", test.name, err)
+		}
+		got, err := check(words, request)
+		if err != nil {
+			t.Fatalf("%s: check() = %v", test.name, err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: check() = %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
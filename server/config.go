@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -14,6 +15,18 @@ type Config struct {
 	DbUserName         string
 	DbPassword         string
 	DBConnectionString string
+	// RefreshInterval is how often the word list is checked for changes, zero disables it
+	RefreshInterval time.Duration
+	// Confusables is where the confusables table comes from, a file path,
+	// "database" for the mw_bad_words_confusables table, "leetspeak" for the built in
+	// one with the leetspeak, or empty for the built in one
+	Confusables string
+	// CollapseRepeats is the default of the words that do not set bw_collapse_repeats
+	CollapseRepeats bool
+	// Exceptions loads mw_bad_words_exceptions, the matches inside its phrases are dropped
+	Exceptions bool
+	// Engine is the matcher the words are loaded into, "maptree" or the plain trie "tree"
+	Engine string
 }
 
 func Configure() *Config {
@@ -28,9 +41,31 @@ func Configure() *Config {
 	dbAddress := os.Getenv("DB_ADDRESS")
 	dbUserName := os.Getenv("DB_USERNAME")
 	dbPassword := os.Getenv("DB_PASSWORD")
+	var refreshInterval time.Duration
+	if interval := os.Getenv("REFRESH_INTERVAL"); interval != "" {
+		var err error
+		if refreshInterval, err = time.ParseDuration(interval); err != nil || refreshInterval < 0 {
+			fmt.Println("REFRESH_INTERVAL must be a duration such as 30s or 5m")
+			return nil
+		}
+	}
+
+	engine := os.Getenv("ENGINE")
+	if engine == "" {
+		engine = "maptree"
+	}
+	if engine != "maptree" && engine != "tree" {
+		fmt.Println("ENGINE must be maptree or tree")
+		return nil
+	}
 
-	if socketPath == "" || dbName == "" || dbUserName == "" || dbPassword == "" || dbType == "" || dbAddress == "" {
-		fmt.Println("SOCKET_PATH, DB_NAME, DB_USERNAME, DB_PASSWORD, DB_TYPE and DB_ADDRESS environment variables are required")
+	if socketPath == "" || dbName == "" || dbType == "" {
+		fmt.Println("SOCKET_PATH, DB_NAME and DB_TYPE environment variables are required")
+		return nil
+	}
+	// sqlite is a local file, only the server databases need an address and credentials
+	if dbType != "sqlite" && (dbUserName == "" || dbPassword == "" || dbAddress == "") {
+		fmt.Println("DB_USERNAME, DB_PASSWORD and DB_ADDRESS environment variables are required")
 		return nil
 	}
 	dbConnectionString := ""
@@ -51,6 +86,11 @@ func Configure() *Config {
 		SocketPath:         socketPath,
 		DBType:             dbType,
 		DBConnectionString: dbConnectionString,
+		RefreshInterval:    refreshInterval,
+		Confusables:        os.Getenv("CONFUSABLES"),
+		CollapseRepeats:    os.Getenv("COLLAPSE_REPEATS") == "true",
+		Exceptions:         os.Getenv("EXCEPTIONS") == "true",
+		Engine:             engine,
 	}
 }
 
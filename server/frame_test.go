@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	payloads := [][]byte{[]byte("a bad word"), {}, []byte("מילה"), bytes.Repeat([]byte("x"), 70000)}
+	var buffer bytes.Buffer
+	for _, payload := range payloads {
+		if err := WriteFrame(&buffer, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range payloads {
+		got, err := ReadFrame(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReadFrame() = %q, want %q", got, want)
+		}
+	}
+	// the connection was closed between frames
+	if _, err := ReadFrame(&buffer); err != io.EOF {
+		t.Errorf("ReadFrame() at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	header := func(size uint32) []byte {
+		return binary.BigEndian.AppendUint32(nil, size)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"truncated payload", append(header(10), "short"...), io.ErrUnexpectedEOF},
+		{"truncated header", []byte{0, 0}, io.ErrUnexpectedEOF},
+		{"no payload", header(3), io.ErrUnexpectedEOF},
+		{"oversized", header(MaxFrameSize + 1), nil},
+	}
+	for _, test := range tests {
+		_, err := ReadFrame(bytes.NewReader(test.input))
+		if err == nil {
+			t.Errorf("%s: ReadFrame() did not fail", test.name)
+		} else if test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%s: ReadFrame() = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestWriteFrameTooBig(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteFrame(&buffer, make([]byte, MaxFrameSize+1)); err == nil {
+		t.Error("WriteFrame() of an oversized payload did not fail")
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("WriteFrame() wrote %d bytes of an oversized payload", buffer.Len())
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+)
+
+// HeaderMark starts a request that carries options. such a request is the mark,
+// a line with the options as json, and then the text. any other request is
+// the text alone, with the default options.
+const HeaderMark = '\x01'
+
+// Options are what a request may ask for in its header.
+type Options struct {
+	// Version is the response format, 1 is the bare array of [start, end] pairs,
+	// 2 is an array of objects with the details of every match: its text, the
+	// entry that matched, its row id and its flags.
+	Version int `json:"version"`
+	// MinSeverity drops the matches of the words with a lower severity.
+	MinSeverity int `json:"minSeverity"`
+	// Categories keeps only the matches of the words in one of these categories, all of them if empty.
+	Categories []string `json:"categories"`
+	// Mask asks for the text with the matches hidden, next to the matches in the
+	// version's format. empty leaves the text out.
+	Mask matcher.MaskMode `json:"mask"`
+	// Overlaps is what is done with the matches that overlap, empty keeps them all.
+	Overlaps matcher.OverlapPolicy `json:"overlaps"`
+	// Offsets is the unit of the positions in the response, empty is runes.
+	Offsets matcher.OffsetUnit `json:"offsets"`
+}
+
+// Wants reports whether a match of a word with this severity and category is returned.
+func (o Options) Wants(severity int, category string) bool {
+	return severity >= o.MinSeverity && (len(o.Categories) == 0 || slices.Contains(o.Categories, category))
+}
+
+type Request struct {
+	Options
+	Text string
+}
+
+// ParseRequest splits the payload of a request into its options and its text.
+func ParseRequest(payload []byte) (Request, error) {
+	request := Request{Options: Options{Version: 1}}
+	if len(payload) == 0 || payload[0] != HeaderMark {
+		request.Text = string(payload)
+		return request, nil
+	}
+	header, text, found := bytes.Cut(payload[1:], []byte{'\n'})
+	if !found {
+		return request, fmt.Errorf("the request header is not followed by a new line")
+	}
+	if err := json.Unmarshal(header, &request.Options); err != nil {
+		return request, fmt.Errorf("failed to parse the request header: %w", err)
+	}
+	if request.Version < 1 || request.Version > 2 {
+		return request, fmt.Errorf("unknown response version %d", request.Version)
+	}
+	if request.MinSeverity < 0 {
+		return request, fmt.Errorf("the minimal severity can not be negative")
+	}
+	if request.Mask != "" && !request.Mask.Valid() {
+		return request, fmt.Errorf("unknown mask %q", request.Mask)
+	}
+	if request.Overlaps != "" && !request.Overlaps.Valid() {
+		return request, fmt.Errorf("unknown overlap policy %q", request.Overlaps)
+	}
+	if request.Offsets != "" && !request.Offsets.Valid() {
+		return request, fmt.Errorf("unknown offset unit %q", request.Offsets)
+	}
+	request.Text = string(text)
+	return request, nil
+}
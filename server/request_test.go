@@ -0,0 +1,72 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Request
+		fails   bool
+	}{
+		{name: "raw", payload: "a bad word", want: Request{Options: Options{Version: 1}, Text: "a bad word"}},
+		{name: "empty", payload: "", want: Request{Options: Options{Version: 1}}},
+		{name: "raw with a new line", payload: "{\"version\":2}\nbad", want: Request{Options: Options{Version: 1}, Text: "{\"version\":2}\nbad"}},
+		{name: "empty header", payload: "\x01{}\nbad", want: Request{Options: Options{Version: 1}, Text: "bad"}},
+		{name: "version 2", payload: "\x01{\"version\":2}\nbad\nword", want: Request{Options: Options{Version: 2}, Text: "bad\nword"}},
+		{name: "filters", payload: "\x01{\"minSeverity\":2,\"categories\":[\"hate\"]}\nbad",
+			want: Request{Options: Options{Version: 1, MinSeverity: 2, Categories: []string{"hate"}}, Text: "bad"}},
+		{name: "mask", payload: "\x01{\"mask\":\"first\"}\nbad", want: Request{Options: Options{Version: 1, Mask: matcher.MaskFirstLetter}, Text: "bad"}},
+		{name: "overlaps", payload: "\x01{\"overlaps\":\"longest\"}\nbad", want: Request{Options: Options{Version: 1, Overlaps: matcher.OverlapLongest}, Text: "bad"}},
+		{name: "offsets", payload: "\x01{\"offsets\":\"utf16\"}\nbad", want: Request{Options: Options{Version: 1, Offsets: matcher.OffsetUTF16}, Text: "bad"}},
+		{name: "no new line", payload: "\x01{\"version\":2}", fails: true},
+		{name: "bad json", payload: "\x01{version:2}\nbad", fails: true},
+		{name: "version 0", payload: "\x01{\"version\":0}\nbad", fails: true},
+		{name: "version 3", payload: "\x01{\"version\":3}\nbad", fails: true},
+		{name: "negative severity", payload: "\x01{\"minSeverity\":-1}\nbad", fails: true},
+		{name: "unknown mask", payload: "\x01{\"mask\":\"stars\"}\nbad", fails: true},
+		{name: "unknown overlaps", payload: "\x01{\"overlaps\":\"first\"}\nbad", fails: true},
+		{name: "unknown offsets", payload: "\x01{\"offsets\":\"utf8\"}\nbad", fails: true},
+	}
+	for _, test := range tests {
+		got, err := ParseRequest([]byte(test.payload))
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: ParseRequest() did not fail", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseRequest() = %v", test.name, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ParseRequest() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWants(t *testing.T) {
+	options := Options{MinSeverity: 2, Categories: []string{"hate", "spam"}}
+	tests := []struct {
+		severity int
+		category string
+		want     bool
+	}{
+		{2, "hate", true},
+		{3, "spam", true},
+		{1, "hate", false},
+		{5, "profanity", false},
+	}
+	for _, test := range tests {
+		if got := options.Wants(test.severity, test.category); got != test.want {
+			t.Errorf("Wants(%d, %q) = %v, want %v", test.severity, test.category, got, test.want)
+		}
+	}
+	if !(Options{}).Wants(0, "") {
+		t.Error("the zero Options do not want a match")
+	}
+}
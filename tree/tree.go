@@ -1,5 +1,6 @@
 /*
 Package tree provides functionality for managing a tree data structure tailored for word filtering.
+It is the plain trie engine of the service, an alternative to maptree selected with ENGINE=tree.
 
 Usage:
 	import "github.com/mekavehamichlolay/bad-word-service/tree"
@@ -17,7 +18,7 @@ Add a word to the Tree with optional restrictions on starting and ending charact
 Check if a text contains any words that are present in the Tree:
 	positions := tree.HasWord(text string)
 	- text: The text to be checked.
-	Returns a slice of pairs of indices representing the start and end positions of found words in the text.
+	Returns a slice of pairs of rune indices representing the start and end positions of found words in the text.
 
 Check if a word is present in the Tree:
 	found := tree.Has(word string)
@@ -45,30 +46,50 @@ Examples of Special Syntax:
 
 Note: The special characters '"' "'" " " "_", and '\' are also considered as word characters.
 
+The text is read rune by rune and the hebrew marks are skipped. Unlike maptree the tree
+does not normalize the text or apply confusables and exceptions, and ignores the allow separators,
+collapse repeats and max distance columns of mw_bad_words. the rows that set them are loaded
+without them and listed as ignored in the Report.
 */
 
 package tree
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
 	"github.com/mekavehamichlolay/bad-word-service/utils"
 )
 
 type Node struct {
-	Children         map[rune]*Node
-	IsFullWord       bool
-	EndOfWordOnly    bool
-	DoesNotStartWith []rune
-	DoesNotEndWith   []rune
+	Children map[rune]*Node
+	// Words are the entries that end in this node
+	Words []*matcher.Word
 }
 
 type Tree struct {
-	Root *Node
+	// mutex guards root against a reset while a text is checked
+	mutex sync.RWMutex
+	// reload is held for the whole of a Reset, so the resets run one at a time
+	reload sync.Mutex
+	root   *Node
+	report matcher.LoadReport
 }
 
-func NewTree() TreeInterface {
-	return &Tree{Root: &Node{Children: make(map[rune]*Node)}}
+var _ matcher.Matcher = (*Tree)(nil)
+
+func NewTree() *Tree {
+	return &Tree{root: newNode()}
+}
+
+func newNode() *Node {
+	return &Node{Children: make(map[rune]*Node)}
 }
 
 type TreeInterface interface {
@@ -78,187 +99,292 @@ type TreeInterface interface {
 }
 
 func (t *Tree) AddWord(word string, dontStartWith []rune, dontFinishWith []rune) error {
-	if len(word) < 2 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return add(t.root, &matcher.Word{Pattern: word, DontStartWith: dontStartWith, DontEndWith: dontFinishWith})
+}
+
+// add adds the words word.Pattern stands for under root. word carries the rest of the entry,
+// add fills in the anchors. either all the words are added or none of them.
+func add(root *Node, word *matcher.Word) error {
+	if word.Severity < 0 {
+		return fmt.Errorf("the severity can not be negative")
+	}
+	pattern := []rune(word.Pattern)
+	if len(pattern) < 2 {
 		return fmt.Errorf("word length must be at least two characters")
 	}
-	cur := t.Root
-	if word[0] == '^' {
-		if _, ok := cur.Children[' ']; !ok {
-			cur.Children[' '] = &Node{Children: make(map[rune]*Node)}
-		}
-		cur = cur.Children[' ']
-		word = word[1:]
-		if len(word) < 2 {
+	if pattern[0] == '^' {
+		word.StartOfWordOnly = true
+		pattern = pattern[1:]
+		if len(pattern) < 2 {
 			return fmt.Errorf("word length must be at least two characters")
 		}
 	}
-	endNodes, err := add(word, cur)
+	words, endOfWordOnly, err := expand(pattern)
 	if err != nil {
 		return err
 	}
-	for _, node := range endNodes {
-		node.DoesNotStartWith = dontStartWith
-		node.DoesNotEndWith = dontFinishWith
-	}
-	return nil
-}
-func add(word string, node *Node) ([]*Node, error) {
-	var nodes []*Node
-	if len(word) == 0 {
-		return nil, fmt.Errorf("you passed an empty string")
-	}
-	char := utils.ToLowerCase(rune(word[0]))
-	if utils.IsExpectedAsCharacter(char) {
-		if _, ok := node.Children[char]; !ok {
-			node.Children[char] = &Node{Children: make(map[rune]*Node)}
+	word.EndOfWordOnly = endOfWordOnly
+	word.DontStartWith = utils.FoldRunes(word.DontStartWith)
+	word.DontEndWith = utils.FoldRunes(word.DontEndWith)
+	for _, w := range words {
+		if node := find(root, w); node != nil && len(node.Words) > 0 {
+			return fmt.Errorf("the word %s already exists", string(w))
 		}
-		if len(word) == 1 {
-			if node.Children[char].IsFullWord {
-				return nil, fmt.Errorf("the word %s already exists", word)
+	}
+	for _, w := range words {
+		cur := root
+		for _, char := range w {
+			next, ok := cur.Children[char]
+			if !ok {
+				next = newNode()
+				cur.Children[char] = next
 			}
-			node.Children[char].IsFullWord = true
-			nodes = append(nodes, node.Children[char])
-			return nodes, nil
+			cur = next
 		}
-		return add(word[1:], node.Children[char])
-	}
-	if char == '$' && len(word) == 1 {
-		node.IsFullWord = true
-		node.EndOfWordOnly = true
-		nodes = append(nodes, node)
-		return nodes, nil
-	}
-	if char == '[' {
-		// multiple options
-		if len(word) < 4 {
-			return nil, fmt.Errorf("it does not make sense to have less then 2 optional chararcters or a closing bracket and question mark")
+		if len(cur.Words) == 0 {
+			// two variants of the pattern may be the same word
+			cur.Words = append(cur.Words, word)
 		}
-		word = word[1:]
-		var multiOptionChars []rune
-		for word[0] != ']' {
-			if len(word) < 2 {
-				return nil, fmt.Errorf("you have an open bracket without a closing bracket")
+	}
+	return nil
+}
+
+// expand returns the folded words pattern stands for, and whether it ends with a $.
+func expand(pattern []rune) ([][]rune, bool, error) {
+	words := [][]rune{nil}
+	for i := 0; i < len(pattern); i++ {
+		char := utils.Fold(pattern[i])
+		switch {
+		case utils.IsHebrewMark(char):
+		case utils.IsExpectedAsCharacter(char):
+			for k := range words {
+				words[k] = append(words[k], char)
 			}
-			char = utils.ToLowerCase(rune(word[0]))
-			if !utils.IsExpectedAsCharacter(char) {
-				return nil, fmt.Errorf("you have a non character in the optional part %s", word)
+		case char == '$' && i == len(pattern)-1:
+			return words, true, nil
+		case char == '[':
+			end := slices.Index(pattern[i:], ']')
+			if end == -1 {
+				return nil, false, fmt.Errorf("you have an open bracket without a closing bracket")
 			}
-			multiOptionChars = append(multiOptionChars, char)
-			word = word[1:]
-		}
-		if len(multiOptionChars) < 2 && (len(word) < 2 || word[1] != '?') {
-			return nil, fmt.Errorf("you have less than 2 optional characters")
-		}
-		if len(word) < 2 {
-			nodes = appendMultiOptionChars(multiOptionChars, node, true)
-			return nodes, nil
-		}
-		if word[1] == '?' && len(word) == 2 {
-			nodes = appendMultiOptionChars(multiOptionChars, node, true)
-			node.IsFullWord = true
-			nodes = append(nodes, node)
-			return nodes, nil
-		}
-		nodes = appendMultiOptionChars(multiOptionChars, node, false)
-		if word[1] == '?' {
-			nodes = append(nodes, node)
-			word = word[2:]
-		} else {
-			word = word[1:]
-		}
-		var returnedNodes []*Node
-		for _, n := range nodes {
-			returned, err := add(word, n)
-			if err != nil {
-				return nil, err
+			var options []rune
+			for _, option := range pattern[i+1 : i+end] {
+				option = utils.Fold(option)
+				if !utils.IsExpectedAsCharacter(option) {
+					return nil, false, fmt.Errorf("you have a non character in the optional part %s", string(pattern[i:]))
+				}
+				options = append(options, option)
+			}
+			i += end
+			optional := i+1 < len(pattern) && pattern[i+1] == '?'
+			if len(options) < 2 && !optional {
+				return nil, false, fmt.Errorf("you have less than 2 optional characters")
 			}
-			returnedNodes = append(returnedNodes, returned...)
+			var expanded [][]rune
+			if optional {
+				expanded = append(expanded, words...)
+				i++
+			}
+			for _, w := range words {
+				for _, option := range options {
+					expanded = append(expanded, append(slices.Clip(w), option))
+				}
+			}
+			words = expanded
+		default:
+			return nil, false, fmt.Errorf("you have a non character in your word %s", string(pattern))
 		}
-		return returnedNodes, nil
 	}
-	return nil, fmt.Errorf("you have a non character in your word %s", word)
+	return words, false, nil
 }
-func appendMultiOptionChars(chars []rune, node *Node, isWordEnd bool) []*Node {
-	var nodes []*Node
-	for _, char := range chars {
-		if _, ok := node.Children[char]; !ok {
-			node.Children[char] = &Node{Children: make(map[rune]*Node)}
-		}
-		if isWordEnd {
-			node.Children[char].IsFullWord = true
+
+// find returns the node of word, or nil if there is none.
+func find(root *Node, word []rune) *Node {
+	cur := root
+	for _, char := range word {
+		if cur = cur.Children[char]; cur == nil {
+			return nil
 		}
-		nodes = append(nodes, node.Children[char])
 	}
-	return nodes
+	return cur
 }
 
 func (t *Tree) HasWord(text string) [][2]uint {
 	var result [][2]uint
-	for p := range text {
-		if p == 0 || text[p-1] == '\n' {
-			if child, ok := t.Root.Children[' ']; ok {
-				if returned := walker(child, text, uint16(p), uint16(p)); returned != 0 {
-					result = append(result, [2]uint{uint(p), uint(returned)})
-				}
-			}
-		}
-		if returned := walker(t.Root, text, uint16(p), uint16(p)); returned != 0 {
-			result = append(result, [2]uint{uint(p), uint(returned)})
-		}
+	for _, match := range t.Matches(text) {
+		result = append(result, [2]uint{match.Start, match.End})
 	}
 	return result
 }
 
-func walker(node *Node, text string, startPosition, curPosition uint16) uint16 {
-	char := utils.ToLowerCase(rune(text[curPosition]))
-	if !utils.IsExpectedAsCharacter(char) {
-		char = ' '
-	}
-	newNode, ok := node.Children[char]
-	if !ok {
-		return 0
-	}
-	if newNode.IsFullWord {
-		if newNode.EndOfWordOnly {
-			if curPosition == uint16(len(text)-1) || utils.IsEndOfWordSign(rune(text[curPosition+1])) {
-				return curPosition
+// Matches returns the words found in text, sorted by their start and end.
+// the positions are rune positions in text.
+func (t *Tree) Matches(text string) []matcher.Match {
+	// letters are the folded runes of the text without the hebrew marks, letters[k]
+	// came from the text runes starts[k] up to ends[k], the marks after it included
+	var letters []rune
+	var starts, ends []int
+	for i, r := range []rune(text) {
+		if utils.IsHebrewMark(r) {
+			if len(ends) > 0 {
+				ends[len(ends)-1] = i + 1
 			}
-			return 0
+			continue
 		}
-		if len(newNode.DoesNotStartWith) > 0 && startPosition > 0 {
-			for _, char := range newNode.DoesNotStartWith {
-				if utils.ToLowerCase(rune(text[startPosition-1])) == char {
-					return 0
-				}
+		letters = append(letters, utils.Fold(r))
+		starts = append(starts, i)
+		ends = append(ends, i+1)
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	var result []matcher.Match
+	for start := range letters {
+		cur := t.root
+		for end := start + 1; end <= len(letters); end++ {
+			if cur = cur.Children[letters[end-1]]; cur == nil {
+				break
 			}
-		}
-		if len(newNode.DoesNotEndWith) > 0 && curPosition+1 < uint16(len(text)-1) {
-			for _, char := range newNode.DoesNotEndWith {
-				if utils.ToLowerCase(rune(text[curPosition+1])) == char {
-					return 0
+			for _, word := range cur.Words {
+				// the same checks as maptree, so both engines agree on the word boundaries
+				if word.Allowed(letters, start, end) {
+					result = append(result, matcher.Match{Start: uint(starts[start]), End: uint(ends[end-1]), Word: word})
 				}
 			}
 		}
-		return curPosition
-	}
-	if uint16(len(text)-1) == curPosition {
-		return 0
 	}
-	return walker(newNode, text, startPosition, curPosition+1)
+	return result
 }
 
 func (t *Tree) Has(word string) bool {
-	return has(t.Root, word) || has(t.Root, " "+word)
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	node := find(t.root, utils.FoldRunes([]rune(word)))
+	return node != nil && len(node.Words) > 0
+}
+
+// Len returns the number of words in the tree, after expansion.
+func (t *Tree) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	count := 0
+	walk(t.root, nil, func([]rune, *matcher.Word) { count++ })
+	return count
 }
 
-func has(node *Node, word string) bool {
-	char := rune(word[0])
-	child, ok := node.Children[char]
-	if !ok {
-		return false
+// walk calls fn for every word under node, prefix is the path to node.
+func walk(node *Node, prefix []rune, fn func(word []rune, node *matcher.Word)) {
+	if len(node.Words) > 0 {
+		fn(prefix, node.Words[0])
+	}
+	for char, child := range node.Children {
+		walk(child, append(slices.Clip(prefix), char), fn)
 	}
-	if len(word) == 1 {
-		return node.Children[char].IsFullWord
+}
+
+// Entries calls fn for every word in the tree that matches the filter, sorted by word.
+func (t *Tree) Entries(filter matcher.Filter, fn func(matcher.Entry) error) error {
+	var entries []matcher.Entry
+	t.mutex.RLock()
+	walk(t.root, nil, func(word []rune, node *matcher.Word) {
+		if !filter.Match(string(word)) {
+			return
+		}
+		entries = append(entries, node.Entry(string(word)))
+	})
+	t.mutex.RUnlock()
+	slices.SortFunc(entries, func(a, b matcher.Entry) int { return strings.Compare(a.Word, b.Word) })
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
 	}
-	return has(child, word[1:])
+	return nil
+}
+
+// Report returns the report of the last reset.
+func (t *Tree) Report() matcher.LoadReport {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.report
+}
+
+// Reset loads the words returned by query, it selects the columns of mw_bad_words
+// in the order database.BadWordsQuery lists them. the rows that can not be loaded are
+// skipped and listed in the Report, if none loaded the current words stay.
+// the resets run one at a time.
+func (t *Tree) Reset(ctx context.Context, conn *sql.Conn, query string) error {
+	defer conn.Close()
+	t.reload.Lock()
+	defer t.reload.Unlock()
+	report := matcher.LoadReport{Time: time.Now(), Skipped: []matcher.RowError{}}
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return t.fail(report, err)
+	}
+	defer rows.Close()
+	root := newNode()
+	for rows.Next() {
+		var word matcher.Word
+		var dontStartWith, dontEndWith string
+		// the tree does not support these options, the rows that set them are loaded without them
+		var allowSeparators bool
+		var collapseRepeats sql.NullBool
+		var maxDistance int
+		if err := rows.Scan(&word.ID, &word.Pattern, &dontStartWith, &dontEndWith, &word.AllowPrefixes, &allowSeparators,
+			&collapseRepeats, &maxDistance, &word.Severity, &word.Category, &word.Replacement); err != nil {
+			report.Skipped = append(report.Skipped, matcher.RowError{ID: word.ID, Pattern: word.Pattern, Error: err.Error()})
+			continue
+		}
+		word.DontStartWith, word.DontEndWith = []rune(dontStartWith), []rune(dontEndWith)
+		if err := add(root, &word); err != nil {
+			report.Skipped = append(report.Skipped, matcher.RowError{ID: word.ID, Pattern: word.Pattern, Error: err.Error()})
+			continue
+		}
+		if ignored := ignoredOptions(allowSeparators, collapseRepeats.Bool, maxDistance); ignored != "" {
+			report.Ignored = append(report.Ignored, matcher.RowError{ID: word.ID, Pattern: word.Pattern,
+				Error: "the tree engine ignores " + ignored})
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return t.fail(report, err)
+	}
+	if err := rows.Err(); err != nil {
+		return t.fail(report, err)
+	}
+	if len(root.Children) == 0 {
+		return t.fail(report, fmt.Errorf("the database returned no words, keeping the current list"))
+	}
+	walk(root, nil, func([]rune, *matcher.Word) { report.Words++ })
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.root = root
+	t.report = report
+	return nil
+}
+
+// ignoredOptions lists the options of a row the tree does not support, empty if the row sets none.
+func ignoredOptions(allowSeparators, collapseRepeats bool, maxDistance int) string {
+	var ignored []string
+	if allowSeparators {
+		ignored = append(ignored, "bw_allow_separators")
+	}
+	if collapseRepeats {
+		ignored = append(ignored, "bw_collapse_repeats")
+	}
+	if maxDistance != 0 {
+		ignored = append(ignored, "bw_max_distance")
+	}
+	return strings.Join(ignored, ", ")
+}
+
+// fail records a reset that did not replace the words, and returns err.
+func (t *Tree) fail(report matcher.LoadReport, err error) error {
+	report.Words = t.Len()
+	report.Error = err.Error()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.report = report
+	return err
 }
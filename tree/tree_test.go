@@ -0,0 +1,104 @@
+package tree
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mekavehamichlolay/bad-word-service/maptree"
+	"github.com/mekavehamichlolay/bad-word-service/matcher"
+)
+
+var words = [][3]string{
+	{"bad", "", ""},
+	{"badword", "", ""},
+	{"^start", "", ""},
+	{"end$", "", ""},
+	{"z[ab]?cd", "x", "y"},
+	{"מילה", "ה", ""},
+	{"^רע[הו]$", "", ""},
+}
+
+func testTree(t *testing.T) (*Tree, *maptree.Tree) {
+	t.Helper()
+	tree, mapTree := NewTree(), maptree.NewTree()
+	for _, word := range words {
+		if err := tree.AddWord(word[0], []rune(word[1]), []rune(word[2])); err != nil {
+			t.Fatalf("AddWord(%q) = %v", word[0], err)
+		}
+		if err := mapTree.AddWord([]rune(word[0]), []rune(word[1]), []rune(word[2]), maptree.Options{}); err != nil {
+			t.Fatalf("maptree AddWord(%q) = %v", word[0], err)
+		}
+	}
+	return tree, mapTree
+}
+
+func TestHasWord(t *testing.T) {
+	tree, mapTree := testTree(t)
+	tests := []struct {
+		text string
+		want [][2]uint
+	}{
+		{"a badword here", [][2]uint{{2, 5}, {2, 9}}},
+		{"start restart", [][2]uint{{0, 5}}},
+		{"the end endless", [][2]uint{{4, 7}}},
+		{"zcd zacd xzbcd zcdy", [][2]uint{{0, 3}, {4, 8}}},
+		// the offsets count runes, and a mark belongs to the letter before it
+		{"מִילָה המילה", [][2]uint{{0, 6}}},
+		{"רעה, ורעו רעו", [][2]uint{{0, 3}, {10, 13}}},
+		{"😀bad", [][2]uint{{1, 4}}},
+		{"BAD", [][2]uint{{0, 3}}},
+		{"nothing", nil},
+	}
+	for _, test := range tests {
+		got := tree.HasWord(test.text)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("HasWord(%q) = %v, want %v", test.text, got, test.want)
+		}
+		// the engines agree on the words both support
+		if want := mapTree.HasWord(test.text); !slices.Equal(got, want) {
+			t.Errorf("HasWord(%q) = %v, maptree found %v", test.text, got, want)
+		}
+	}
+}
+
+func TestAddWordErrors(t *testing.T) {
+	tree, _ := testTree(t)
+	for _, word := range []string{"a", "^a", "[ab", "a[b]c", "a!b", "bad"} {
+		if err := tree.AddWord(word, nil, nil); err == nil {
+			t.Errorf("AddWord(%q) did not fail", word)
+		}
+	}
+	// a word that failed leaves no variant behind
+	if err := tree.AddWord("[xy]?bad", nil, nil); err == nil {
+		t.Error("AddWord() of a variant that exists did not fail")
+	}
+	if tree.Has("xbad") {
+		t.Error("Has() found a variant of a word that failed")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	tree, mapTree := testTree(t)
+	if got := tree.Len(); got != 10 {
+		t.Errorf("Len() = %d, want 10", got)
+	}
+	entries := func(words matcher.Matcher, prefix string) []string {
+		var got []string
+		if err := words.Entries(matcher.Filter{Prefix: prefix}, func(entry matcher.Entry) error {
+			got = append(got, entry.Word)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	for prefix, want := range map[string][]string{"z": {"zacd", "zbcd", "zcd"}, "zac": {"zacd"}} {
+		if got := entries(tree, prefix); !slices.Equal(got, want) {
+			t.Errorf("Entries(%q) = %v, want %v", prefix, got, want)
+		}
+		// maptree lists the words its patterns expand to too
+		if got := entries(mapTree, prefix); !slices.Equal(got, want) {
+			t.Errorf("maptree Entries(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
@@ -18,12 +18,33 @@ const (
 	QAMATS_QATAN = 'ׇ'
 	COMMA        = ','
 	DOT          = '.'
+	BET          = 'ב'
+	HE           = 'ה'
+	VAV          = 'ו'
+	LAMED        = 'ל'
+	SHIN         = 'ש'
+	FINAL_KAF    = 'ך'
+	KAF          = 'כ'
+	FINAL_MEM    = 'ם'
+	MEM          = 'מ'
+	FINAL_NUN    = 'ן'
+	NUN          = 'נ'
+	FINAL_PE     = 'ף'
+	PE           = 'פ'
+	FINAL_TSADI  = 'ץ'
+	TSADI        = 'צ'
 )
 
 func IsNiqqud(r rune) bool {
 	return r >= ETNAHTA && r <= QAMATS_QATAN
 }
 
+// IsHebrewMark reports whether r is a hebrew vowel point or cantillation mark,
+// the niqqud range without the punctuation in it, such as the maqaf and sof pasuq.
+func IsHebrewMark(r rune) bool {
+	return IsNiqqud(r) && unicode.Is(unicode.Mn, r)
+}
+
 func IsHebrewLetter(letter rune) bool {
 	return letter >= ALEPH && letter <= TAV
 }
@@ -72,3 +93,48 @@ func ToLowerCase(letter rune) rune {
 	}
 	return letter
 }
+
+// IsHebrewPrefixLetter reports whether letter is one of the letters hebrew attaches
+// to the start of a word, ו ה ב כ ל מ and ש.
+func IsHebrewPrefixLetter(letter rune) bool {
+	switch letter {
+	case VAV, HE, BET, KAF, LAMED, MEM, SHIN:
+		return true
+	}
+	return false
+}
+
+// ToBaseLetter returns the regular form of a hebrew final letter, ך becomes כ and so on.
+// every other letter is returned as is.
+func ToBaseLetter(letter rune) rune {
+	switch letter {
+	case FINAL_KAF:
+		return KAF
+	case FINAL_MEM:
+		return MEM
+	case FINAL_NUN:
+		return NUN
+	case FINAL_PE:
+		return PE
+	case FINAL_TSADI:
+		return TSADI
+	}
+	return letter
+}
+
+// Fold returns the form letters are compared in, lower case and without final letters.
+func Fold(letter rune) rune {
+	return ToBaseLetter(ToLowerCase(letter))
+}
+
+// FoldRunes returns a copy of letters with every letter folded.
+func FoldRunes(letters []rune) []rune {
+	if letters == nil {
+		return nil
+	}
+	folded := make([]rune, len(letters))
+	for i, letter := range letters {
+		folded[i] = Fold(letter)
+	}
+	return folded
+}